@@ -3,7 +3,6 @@ package jwt
 import (
 	"errors"
 	"log/slog"
-	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -11,35 +10,44 @@ import (
 )
 
 var (
-	SIGNING_KEY = []byte(os.Getenv("SIGNING_KEY"))
-	// todo(nick): pull from app config
-	issuer = "chaiwala"
-
 	ErrInvalidToken         = errors.New("Invalid token")
 	ErrExpiredToken         = errors.New("Expired token")
 	ErrInvalidSigningMethod = errors.New("Unexpected signing method")
 )
 
+type JWTClient struct {
+	signingKey []byte
+	issuer     string
+}
+
+// New creates a client that signs and validates tokens with the given HMAC key.
+func New(signingKey, issuer string) JWTClient {
+	return JWTClient{
+		signingKey: []byte(signingKey),
+		issuer:     issuer,
+	}
+}
+
 type Claims struct {
 	Email  string `json:"email"`
 	UserID int32  `json:"userId"`
 	jwt.RegisteredClaims
 }
 
-func GenerateTokens(email string, userId int32) (string, string, time.Time, error) {
+func (j JWTClient) GenerateTokens(email string, userId int32) (string, string, time.Time, error) {
 	accessExp := time.Now().Add(4 * time.Hour)
 	claims := Claims{
 		Email:  email,
 		UserID: userId,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(accessExp),
-			Issuer:    issuer,
+			Issuer:    j.issuer,
 		},
 	}
 
 	at := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	signedToken, err := at.SignedString(SIGNING_KEY)
+	signedToken, err := at.SignedString(j.signingKey)
 	if err != nil {
 		return "", "", accessExp, err
 	}
@@ -49,12 +57,12 @@ func GenerateTokens(email string, userId int32) (string, string, time.Time, erro
 		UserID: userId,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-			Issuer:    issuer,
+			Issuer:    j.issuer,
 		},
 	}
 
 	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshToken, err := rt.SignedString(SIGNING_KEY)
+	refreshToken, err := rt.SignedString(j.signingKey)
 	if err != nil {
 		return "", "", accessExp, err
 	}
@@ -62,14 +70,14 @@ func GenerateTokens(email string, userId int32) (string, string, time.Time, erro
 	return signedToken, refreshToken, accessExp, nil
 }
 
-func ValidateToken(c fiber.Ctx, token string) (Claims, error) {
+func (j JWTClient) ValidateToken(c fiber.Ctx, token string) (Claims, error) {
 	claims := new(Claims)
 
 	t, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidSigningMethod
 		}
-		return SIGNING_KEY, nil
+		return j.signingKey, nil
 	})
 	if claims.ExpiresAt == nil || claims.ExpiresAt.Time.Before(time.Now()) {
 		return *claims, ErrExpiredToken
@@ -3,11 +3,18 @@ package s3
 import (
 	"context"
 	"io"
+	"time"
+
+	"ChaiwalaBackend/metrics"
+	"ChaiwalaBackend/tracing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type S3Client struct {
@@ -15,11 +22,19 @@ type S3Client struct {
 	BucketName string
 }
 
-// New initializes the client with credentials from env.
-func New(ctx context.Context, awsRegion, s3BucketName string) S3Client {
-	cfg, err := config.LoadDefaultConfig(ctx,
+// New initializes the client. Static credentials are used when provided,
+// otherwise the default AWS credential chain applies.
+func New(ctx context.Context, awsRegion, s3BucketName, accessKeyID, secretAccessKey string) S3Client {
+	opts := []func(*config.LoadOptions) error{
 		config.WithRegion(awsRegion),
-	)
+	}
+	if accessKeyID != "" && secretAccessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -32,34 +47,87 @@ func New(ctx context.Context, awsRegion, s3BucketName string) S3Client {
 
 // Upload uploads an image to the bucket.
 func (s *S3Client) Upload(ctx context.Context, key string, fileReader io.Reader, contentType string) error {
+	ctx, span, start := s.start(ctx, "upload", key)
+	body := &countingReader{r: fileReader}
+
 	uploader := manager.NewUploader(s.client)
 	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(s.BucketName),
 		Key:         aws.String(key),
-		Body:        fileReader,
+		Body:        body,
 		ContentType: aws.String(contentType),
 	})
 
+	span.SetAttributes(attribute.Int64("s3.bytes", body.n))
+	finish(span, "upload", start, err)
+	if err == nil {
+		metrics.S3Bytes.WithLabelValues("upload").Add(float64(body.n))
+	}
 	return err
 }
 
 // Download fetches an object and returns its bytes.
 func (s *S3Client) Download(ctx context.Context, key string) (s3.GetObjectOutput, error) {
+	ctx, span, start := s.start(ctx, "download", key)
 	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.BucketName),
 		Key:    aws.String(key),
 	})
+	finish(span, "download", start, err)
 	if err != nil {
 		return s3.GetObjectOutput{}, err
 	}
+
+	if resp.ContentLength != nil {
+		span.SetAttributes(attribute.Int64("s3.bytes", *resp.ContentLength))
+		metrics.S3Bytes.WithLabelValues("download").Add(float64(*resp.ContentLength))
+	}
 	return *resp, nil
 }
 
 // Delete removes the object from the bucket.
 func (s *S3Client) Delete(ctx context.Context, key string) error {
+	ctx, span, start := s.start(ctx, "delete", key)
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.BucketName),
 		Key:    aws.String(key),
 	})
+	finish(span, "delete", start, err)
 	return err
 }
+
+// Ping checks that the bucket exists and is reachable with the current credentials.
+func (s *S3Client) Ping(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.BucketName),
+	})
+	return err
+}
+
+func (s *S3Client) start(ctx context.Context, operation, key string) (context.Context, trace.Span, time.Time) {
+	ctx, span := tracing.Tracer().Start(ctx, "s3."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("s3.bucket", s.BucketName),
+			attribute.String("s3.key", key),
+		),
+	)
+	return ctx, span, time.Now()
+}
+
+func finish(span trace.Span, operation string, start time.Time, err error) {
+	metrics.S3Duration.WithLabelValues(operation, metrics.Result(err)).Observe(time.Since(start).Seconds())
+	tracing.End(span, err)
+}
+
+// countingReader tracks how many bytes were read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
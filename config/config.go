@@ -0,0 +1,389 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ChaiwalaBackend/middlewares"
+	"ChaiwalaBackend/ratelimit"
+	"ChaiwalaBackend/trending"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DEFAULT_CONFIG_FILE = "config.yaml"
+	DEFAULT_ENV_FILE    = ".env"
+
+	redacted = "[REDACTED]"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// AppConfig holds every setting the server needs. Each field is read from,
+// in increasing order of precedence: its `default` tag, the YAML config file,
+// the .env file, the process environment and finally command line flags.
+//
+// The environment variable name is the field name, the YAML key is the
+// lowercased field name and the flag is the lowercased field name with
+// underscores replaced by dashes (e.g. LOG_LEVEL, log_level, -log-level).
+type AppConfig struct {
+	APP_ENV               string     `default:"DEVELOPMENT" usage:"environment name, PRODUCTION enables JSON logs"`
+	PORT                  string     `default:"8000" usage:"port the http server listens on"`
+	METRICS_PORT          string     `default:"9090" usage:"port /metrics is served on, keep it off the public network"`
+	LOG_LEVEL             slog.Level `default:"INFO" usage:"minimum log level, a name (DEBUG) or number (-4)"`
+	LOG_DEBUG_SAMPLE_RATE float64    `default:"0" usage:"fraction of requests that log at DEBUG regardless of LOG_LEVEL"`
+	POSTGRES_URL          string     `required:"true" secret:"true" usage:"postgres connection string"`
+	AWS_REGION            string     `required:"true" usage:"aws region of the asset bucket"`
+	AWS_ACCESS_KEY_ID     string     `usage:"aws access key, falls back to the default credential chain"`
+	AWS_SECRET_ACCESS_KEY string     `secret:"true" usage:"aws secret key, falls back to the default credential chain"`
+	S3_BUCKET_NAME        string     `required:"true" usage:"bucket assets are uploaded to"`
+	SIGNING_KEY           string     `required:"true" secret:"true" usage:"HMAC key used to sign JWTs"`
+	JWT_ISSUER            string     `default:"chaiwala" usage:"issuer set on generated JWTs"`
+
+	OTEL_EXPORTER               string  `default:"none" usage:"trace exporter: none, stdout or otlp"`
+	OTEL_EXPORTER_OTLP_ENDPOINT string  `usage:"otlp/http endpoint url, e.g. http://localhost:4318"`
+	OTEL_SERVICE_NAME           string  `default:"chaiwala-backend" usage:"service name reported on spans"`
+	OTEL_SAMPLE_RATIO           float64 `default:"1" usage:"fraction of new traces that are sampled"`
+
+	ACCESS_LOG_FORMAT         string        `default:"combined" usage:"access log format: common, combined or json"`
+	ACCESS_LOG_OUTPUT         string        `default:"stdout" usage:"stdout, stderr or a file path that is rotated by size"`
+	ACCESS_LOG_MAX_SIZE_MB    int           `default:"100" usage:"size at which the access log file is rotated"`
+	ACCESS_LOG_MAX_BACKUPS    int           `default:"5" usage:"rotated access log files to keep"`
+	ACCESS_LOG_MAX_AGE_DAYS   int           `default:"28" usage:"days to keep rotated access log files"`
+	ACCESS_LOG_REDACT_HEADERS []string      `default:"Authorization,Cookie" usage:"request headers never written to the access log"`
+	ACCESS_LOG_REDACT_QUERY   []string      `default:"token,access_token,refresh_token" usage:"query parameters never written to the access log"`
+	ACCESS_LOG_SLOW_THRESHOLD time.Duration `default:"1s" usage:"requests slower than this are flagged, 0 disables"`
+
+	RATE_LIMIT_IP       ratelimit.Limit `default:"600/m" usage:"requests per ip across all routes, checked before authentication, off disables"`
+	RATE_LIMIT_DEFAULT  ratelimit.Limit `default:"300/m" usage:"requests per user or ip across all routes, off disables"`
+	RATE_LIMIT_AUTH     ratelimit.Limit `default:"10/m" usage:"requests per ip to /auth"`
+	RATE_LIMIT_FILES    ratelimit.Limit `default:"30/m" usage:"requests per user or ip to /files"`
+	RATE_LIMIT_COMMENTS ratelimit.Limit `default:"30/m" usage:"requests per user or ip to /comments"`
+
+	CORS_ALLOWED_ORIGINS   []string      `usage:"origins allowed to call the api, e.g. https://app.chaiwala.com"`
+	CORS_ALLOW_CREDENTIALS bool          `default:"false" usage:"allow cookies and auth headers on cross origin requests"`
+	CORS_MAX_AGE           time.Duration `default:"10m" usage:"how long browsers may cache preflight responses"`
+	HSTS_MAX_AGE           time.Duration `default:"8760h" usage:"max-age sent in Strict-Transport-Security on https, 0 disables"`
+	BODY_LIMIT_JSON        int           `default:"65536" usage:"max request body in bytes for json routes"`
+	BODY_LIMIT_FILES       int           `default:"10485760" usage:"max request body in bytes for file uploads"`
+
+	IDEMPOTENCY_TTL              time.Duration `default:"24h" usage:"how long responses to requests with an Idempotency-Key are replayed"`
+	IDEMPOTENCY_CLEANUP_INTERVAL time.Duration `default:"1h" usage:"how often expired idempotency keys are deleted"`
+
+	COUNTER_RECONCILE_INTERVAL time.Duration `default:"1h" usage:"how often recipe and comment counters are checked for drift"`
+
+	TRENDING_WINDOWS          trending.Windows `default:"24h,7d,30d" usage:"windows trending recipes are ranked over, the first is the default"`
+	TRENDING_GRAVITY          float64          `default:"1.8" usage:"how fast older recipes fall out of trending"`
+	TRENDING_REFRESH_INTERVAL time.Duration    `default:"10m" usage:"how often trending rankings are recomputed"`
+
+	READINESS_TIMEOUT   time.Duration `default:"2s" usage:"timeout for each dependency check in /readyz"`
+	READINESS_CACHE_TTL time.Duration `default:"5s" usage:"how long /readyz results are cached"`
+
+	SHUTDOWN_TIMEOUT time.Duration `default:"10s" usage:"how long in flight requests and buffered spans get on shutdown"`
+}
+
+// Load builds the AppConfig from all sources and validates it. args are the
+// command line arguments without the program name.
+func Load(args []string) (*AppConfig, error) {
+	ac := new(AppConfig)
+
+	fs := flag.NewFlagSet("chaiwala", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to a YAML config file (default "+DEFAULT_CONFIG_FILE+" if present)")
+	envFile := fs.String("env-file", "", "path to a .env file (default "+DEFAULT_ENV_FILE+" if present)")
+
+	for _, f := range fields(ac) {
+		fs.String(f.flagName(), "", f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	sources := make([]map[string]string, 0, 4)
+
+	yamlValues, err := readYAML(*configFile)
+	if err != nil {
+		return nil, err
+	}
+	sources = append(sources, yamlValues)
+
+	dotenvValues, err := readDotenv(*envFile)
+	if err != nil {
+		return nil, err
+	}
+	sources = append(sources, dotenvValues, environ())
+
+	setFlags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))] = f.Value.String()
+	})
+	sources = append(sources, setFlags)
+
+	var errs []error
+	for _, f := range fields(ac) {
+		raw := f.def
+		for _, src := range sources {
+			if v := strings.TrimSpace(src[f.name]); v != "" {
+				raw = v
+			}
+		}
+
+		if raw == "" {
+			if f.required {
+				errs = append(errs, fmt.Errorf("%s is required", f.name))
+			}
+			continue
+		}
+
+		if err := f.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
+		}
+	}
+
+	errs = append(errs, ac.validate()...)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+
+	return ac, nil
+}
+
+// validate checks enumerated settings and rules spanning multiple fields.
+func (ac *AppConfig) validate() []error {
+	var errs []error
+
+	if ac.CORS_ALLOW_CREDENTIALS && slices.Contains(ac.CORS_ALLOWED_ORIGINS, "*") {
+		errs = append(errs, errors.New("CORS_ALLOWED_ORIGINS can't contain * when CORS_ALLOW_CREDENTIALS is set"))
+	}
+	if !slices.Contains([]string{middlewares.ACCESS_LOG_COMMON, middlewares.ACCESS_LOG_COMBINED, middlewares.ACCESS_LOG_JSON}, ac.ACCESS_LOG_FORMAT) {
+		errs = append(errs, fmt.Errorf("ACCESS_LOG_FORMAT must be %s, %s or %s, got %q",
+			middlewares.ACCESS_LOG_COMMON, middlewares.ACCESS_LOG_COMBINED, middlewares.ACCESS_LOG_JSON, ac.ACCESS_LOG_FORMAT))
+	}
+	if ac.METRICS_PORT == ac.PORT {
+		errs = append(errs, errors.New("METRICS_PORT must differ from PORT"))
+	}
+	if ac.BODY_LIMIT_JSON <= 0 || ac.BODY_LIMIT_FILES <= 0 {
+		errs = append(errs, errors.New("BODY_LIMIT_JSON and BODY_LIMIT_FILES must be positive"))
+	}
+	if ac.IDEMPOTENCY_CLEANUP_INTERVAL <= 0 || ac.COUNTER_RECONCILE_INTERVAL <= 0 || ac.TRENDING_REFRESH_INTERVAL <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_CLEANUP_INTERVAL, COUNTER_RECONCILE_INTERVAL and TRENDING_REFRESH_INTERVAL must be positive"))
+	}
+
+	return errs
+}
+
+// String renders the config with secrets redacted, safe for printing.
+func (ac AppConfig) String() string {
+	var b strings.Builder
+	for i, f := range fields(&ac) {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%s=%s", f.name, f.display())
+	}
+	return b.String()
+}
+
+// LogValue implements slog.LogValuer so logging the config never leaks secrets.
+func (ac AppConfig) LogValue() slog.Value {
+	fs := fields(&ac)
+	attrs := make([]slog.Attr, 0, len(fs))
+	for _, f := range fs {
+		attrs = append(attrs, slog.String(f.name, f.display()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+type field struct {
+	name     string
+	def      string
+	usage    string
+	required bool
+	secret   bool
+	value    reflect.Value
+}
+
+func fields(ac *AppConfig) []field {
+	v := reflect.ValueOf(ac).Elem()
+	t := v.Type()
+
+	out := make([]field, 0, t.NumField())
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		out = append(out, field{
+			name:     sf.Name,
+			def:      sf.Tag.Get("default"),
+			usage:    sf.Tag.Get("usage"),
+			required: sf.Tag.Get("required") == "true",
+			secret:   sf.Tag.Get("secret") == "true",
+			value:    v.Field(i),
+		})
+	}
+	return out
+}
+
+func (f field) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(f.name), "_", "-")
+}
+
+func (f field) display() string {
+	if f.secret {
+		if f.value.IsZero() {
+			return ""
+		}
+		return redacted
+	}
+
+	if s, ok := f.value.Interface().([]string); ok {
+		return strings.Join(s, ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+func (f field) set(raw string) error {
+	switch f.value.Interface().(type) {
+	case slog.Level:
+		var lvl slog.Level
+		if n, err := strconv.Atoi(raw); err == nil {
+			lvl = slog.Level(n)
+		} else if err := lvl.UnmarshalText([]byte(raw)); err != nil {
+			return err
+		}
+		f.value.Set(reflect.ValueOf(lvl))
+		return nil
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.value.Set(reflect.ValueOf(d))
+		return nil
+	case []string:
+		parts := strings.Split(raw, ",")
+		out := make([]string, 0, len(parts))
+		for _, p := range parts {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+		f.value.Set(reflect.ValueOf(out))
+		return nil
+	}
+
+	if u, ok := f.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, f.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported config type %s", f.value.Type())
+	}
+	return nil
+}
+
+// readYAML reads a flat YAML mapping. Keys are matched case-insensitively
+// against field names and lists are joined with commas.
+func readYAML(path string) (map[string]string, error) {
+	path, err := resolvePath(path, DEFAULT_CONFIG_FILE)
+	if err != nil || path == "" {
+		return map[string]string{}, err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		key := strings.ToUpper(k)
+		switch val := v.(type) {
+		case nil:
+			continue
+		case []any:
+			parts := make([]string, 0, len(val))
+			for _, p := range val {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			out[key] = strings.Join(parts, ",")
+		default:
+			out[key] = fmt.Sprint(val)
+		}
+	}
+	return out, nil
+}
+
+func readDotenv(path string) (map[string]string, error) {
+	path, err := resolvePath(path, DEFAULT_ENV_FILE)
+	if err != nil || path == "" {
+		return map[string]string{}, err
+	}
+
+	values, err := godotenv.Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading env file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// resolvePath returns the explicit path, or the fallback if it exists on disk.
+// An explicit path that is missing is an error, a missing fallback is not.
+func resolvePath(path, fallback string) (string, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("config source: %w", err)
+		}
+		return path, nil
+	}
+
+	if _, err := os.Stat(fallback); err != nil {
+		return "", nil
+	}
+	return fallback, nil
+}
+
+func environ() map[string]string {
+	out := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			out[k] = v
+		}
+	}
+	return out
+}
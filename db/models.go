@@ -8,12 +8,50 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type CommentReaction struct {
+	CommentID int32            `json:"commentId"`
+	UserID    int32            `json:"userId"`
+	Reaction  string           `json:"reaction"`
+	CreatedAt pgtype.Timestamp `json:"createdAt"`
+}
+
 type Favorite struct {
 	UserID    int32            `json:"userId"`
 	RecipeID  int32            `json:"recipeId"`
 	CreatedAt pgtype.Timestamp `json:"createdAt"`
 }
 
+type Follow struct {
+	FollowerID int32            `json:"followerId"`
+	FolloweeID int32            `json:"followeeId"`
+	CreatedAt  pgtype.Timestamp `json:"createdAt"`
+}
+
+type IdempotencyKey struct {
+	UserID         int32            `json:"userId"`
+	IdempotencyKey string           `json:"idempotencyKey"`
+	RequestHash    string           `json:"requestHash"`
+	StatusCode     pgtype.Int4      `json:"statusCode"`
+	ContentType    pgtype.Text      `json:"contentType"`
+	ResponseBody   []byte           `json:"responseBody"`
+	CreatedAt      pgtype.Timestamp `json:"createdAt"`
+	ExpiresAt      pgtype.Timestamp `json:"expiresAt"`
+}
+
+type Ingredient struct {
+	ID   int32  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Rating struct {
+	UserID    int32            `json:"userId"`
+	RecipeID  int32            `json:"recipeId"`
+	Stars     int32            `json:"stars"`
+	Review    pgtype.Text      `json:"review"`
+	CreatedAt pgtype.Timestamp `json:"createdAt"`
+	UpdatedAt pgtype.Timestamp `json:"updatedAt"`
+}
+
 type Recipe struct {
 	ID              int32            `json:"id"`
 	UserID          pgtype.Int4      `json:"userId"`
@@ -26,14 +64,38 @@ type Recipe struct {
 	IsPublic        pgtype.Bool      `json:"isPublic"`
 	CreatedAt       pgtype.Timestamp `json:"createdAt"`
 	UpdatedAt       pgtype.Timestamp `json:"updatedAt"`
+	Version         int32            `json:"version"`
+	CommentsCount   int32            `json:"commentsCount"`
+	FavoritesCount  int32            `json:"favoritesCount"`
+	RatingsCount    int32            `json:"ratingsCount"`
+	RatingsSum      int32            `json:"ratingsSum"`
 }
 
 type RecipeComment struct {
-	ID        int32            `json:"id"`
-	RecipeID  pgtype.Int4      `json:"recipeId"`
-	UserID    pgtype.Int4      `json:"userId"`
-	Comment   string           `json:"comment"`
-	CreatedAt pgtype.Timestamp `json:"createdAt"`
+	ID             int32            `json:"id"`
+	RecipeID       pgtype.Int4      `json:"recipeId"`
+	UserID         pgtype.Int4      `json:"userId"`
+	Comment        string           `json:"comment"`
+	CreatedAt      pgtype.Timestamp `json:"createdAt"`
+	ParentID       pgtype.Int4      `json:"parentId"`
+	Depth          int32            `json:"depth"`
+	DeletedAt      pgtype.Timestamp `json:"deletedAt"`
+	ReactionsCount int32            `json:"reactionsCount"`
+}
+
+type RecipeIngredient struct {
+	ID           int32         `json:"id"`
+	RecipeID     int32         `json:"recipeId"`
+	IngredientID int32         `json:"ingredientId"`
+	Position     int32         `json:"position"`
+	Quantity     pgtype.Float8 `json:"quantity"`
+	Unit         pgtype.Text   `json:"unit"`
+	Note         pgtype.Text   `json:"note"`
+}
+
+type RecipeSearch struct {
+	RecipeID int32       `json:"recipeId"`
+	Document interface{} `json:"document"`
 }
 
 type RecipeStep struct {
@@ -44,6 +106,14 @@ type RecipeStep struct {
 	AssetID     pgtype.Text `json:"assetId"`
 }
 
+type TrendingRecipe struct {
+	WindowName string           `json:"windowName"`
+	RecipeID   int32            `json:"recipeId"`
+	TeaType    int32            `json:"teaType"`
+	Score      float64          `json:"score"`
+	ComputedAt pgtype.Timestamp `json:"computedAt"`
+}
+
 type User struct {
 	ID           int32            `json:"id"`
 	Email        string           `json:"email"`
@@ -13,21 +13,29 @@ import (
 
 const addComment = `-- name: AddComment :one
 INSERT INTO recipe_comments (
-  recipe_id, user_id, comment
+  recipe_id, user_id, comment, parent_id, depth
 ) VALUES (
-  $1, $2, $3
+  $1, $2, $3, $4, $5
 )
-RETURNING id, recipe_id, user_id, comment, created_at
+RETURNING id, recipe_id, user_id, comment, created_at, parent_id, depth, deleted_at, reactions_count
 `
 
 type AddCommentParams struct {
 	RecipeID pgtype.Int4 `json:"recipeId"`
 	UserID   pgtype.Int4 `json:"userId"`
 	Comment  string      `json:"comment"`
+	ParentID pgtype.Int4 `json:"parentId"`
+	Depth    int32       `json:"depth"`
 }
 
 func (q *Queries) AddComment(ctx context.Context, arg AddCommentParams) (RecipeComment, error) {
-	row := q.db.QueryRow(ctx, addComment, arg.RecipeID, arg.UserID, arg.Comment)
+	row := q.db.QueryRow(ctx, addComment,
+		arg.RecipeID,
+		arg.UserID,
+		arg.Comment,
+		arg.ParentID,
+		arg.Depth,
+	)
 	var i RecipeComment
 	err := row.Scan(
 		&i.ID,
@@ -35,6 +43,50 @@ func (q *Queries) AddComment(ctx context.Context, arg AddCommentParams) (RecipeC
 		&i.UserID,
 		&i.Comment,
 		&i.CreatedAt,
+		&i.ParentID,
+		&i.Depth,
+		&i.DeletedAt,
+		&i.ReactionsCount,
+	)
+	return i, err
+}
+
+const addRecipeIngredient = `-- name: AddRecipeIngredient :one
+INSERT INTO recipe_ingredients (
+  recipe_id, ingredient_id, position, quantity, unit, note
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, recipe_id, ingredient_id, position, quantity, unit, note
+`
+
+type AddRecipeIngredientParams struct {
+	RecipeID     int32         `json:"recipeId"`
+	IngredientID int32         `json:"ingredientId"`
+	Position     int32         `json:"position"`
+	Quantity     pgtype.Float8 `json:"quantity"`
+	Unit         pgtype.Text   `json:"unit"`
+	Note         pgtype.Text   `json:"note"`
+}
+
+func (q *Queries) AddRecipeIngredient(ctx context.Context, arg AddRecipeIngredientParams) (RecipeIngredient, error) {
+	row := q.db.QueryRow(ctx, addRecipeIngredient,
+		arg.RecipeID,
+		arg.IngredientID,
+		arg.Position,
+		arg.Quantity,
+		arg.Unit,
+		arg.Note,
+	)
+	var i RecipeIngredient
+	err := row.Scan(
+		&i.ID,
+		&i.RecipeID,
+		&i.IngredientID,
+		&i.Position,
+		&i.Quantity,
+		&i.Unit,
+		&i.Note,
 	)
 	return i, err
 }
@@ -73,6 +125,120 @@ func (q *Queries) AddRecipeStep(ctx context.Context, arg AddRecipeStepParams) (R
 	return i, err
 }
 
+const claimIdempotencyKey = `-- name: ClaimIdempotencyKey :one
+INSERT INTO idempotency_keys (
+  user_id, idempotency_key, request_hash, expires_at
+) VALUES (
+  $1, $2, $3, NOW() + make_interval(secs => $4::float8)
+)
+ON CONFLICT (user_id, idempotency_key) DO UPDATE SET
+  request_hash = EXCLUDED.request_hash,
+  status_code = NULL,
+  content_type = NULL,
+  response_body = NULL,
+  created_at = NOW(),
+  expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at < NOW()
+  OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < NOW() - INTERVAL '5 minutes')
+RETURNING user_id, idempotency_key, request_hash, status_code, content_type, response_body, created_at, expires_at
+`
+
+type ClaimIdempotencyKeyParams struct {
+	UserID         int32   `json:"userId"`
+	IdempotencyKey string  `json:"idempotencyKey"`
+	RequestHash    string  `json:"requestHash"`
+	TtlSeconds     float64 `json:"ttlSeconds"`
+}
+
+// Returns no rows when the key is already held by an unexpired request.
+// Claims left in progress for over 5 minutes (e.g. after a crash) are reclaimed.
+func (q *Queries) ClaimIdempotencyKey(ctx context.Context, arg ClaimIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRow(ctx, claimIdempotencyKey,
+		arg.UserID,
+		arg.IdempotencyKey,
+		arg.RequestHash,
+		arg.TtlSeconds,
+	)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.UserID,
+		&i.IdempotencyKey,
+		&i.RequestHash,
+		&i.StatusCode,
+		&i.ContentType,
+		&i.ResponseBody,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const clearTrendingRecipes = `-- name: ClearTrendingRecipes :exec
+DELETE FROM trending_recipes
+WHERE window_name = $1
+`
+
+func (q *Queries) ClearTrendingRecipes(ctx context.Context, windowName string) error {
+	_, err := q.db.Exec(ctx, clearTrendingRecipes, windowName)
+	return err
+}
+
+const countPublicRecipesByTeaType = `-- name: CountPublicRecipesByTeaType :many
+SELECT r.type, count(*) AS count FROM recipes r
+WHERE r.is_public = true
+  AND ($1::integer IS NULL OR r.prep_time_minutes <= $1)
+  AND ($2::integer IS NULL OR r.servings >= $2)
+  AND ($3::integer IS NULL OR r.servings <= $3)
+  AND ($4::integer IS NULL OR r.user_id = $4)
+  AND ($5::timestamp IS NULL OR r.created_at > $5)
+  AND ($6::boolean IS NULL OR (r.asset_id <> '') = $6)
+GROUP BY r.type
+ORDER BY r.type
+`
+
+type CountPublicRecipesByTeaTypeParams struct {
+	MaxPrepTime  pgtype.Int4      `json:"maxPrepTime"`
+	MinServings  pgtype.Int4      `json:"minServings"`
+	MaxServings  pgtype.Int4      `json:"maxServings"`
+	AuthorID     pgtype.Int4      `json:"authorId"`
+	CreatedAfter pgtype.Timestamp `json:"createdAfter"`
+	HasImage     pgtype.Bool      `json:"hasImage"`
+}
+
+type CountPublicRecipesByTeaTypeRow struct {
+	Type  int32 `json:"type"`
+	Count int64 `json:"count"`
+}
+
+// Facet counts for FilterPublicRecipes, ignoring its tea type filter so every
+// tea type chip shows how many recipes selecting it would add.
+func (q *Queries) CountPublicRecipesByTeaType(ctx context.Context, arg CountPublicRecipesByTeaTypeParams) ([]CountPublicRecipesByTeaTypeRow, error) {
+	rows, err := q.db.Query(ctx, countPublicRecipesByTeaType,
+		arg.MaxPrepTime,
+		arg.MinServings,
+		arg.MaxServings,
+		arg.AuthorID,
+		arg.CreatedAfter,
+		arg.HasImage,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountPublicRecipesByTeaTypeRow
+	for rows.Next() {
+		var i CountPublicRecipesByTeaTypeRow
+		if err := rows.Scan(&i.Type, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createRecipe = `-- name: CreateRecipe :one
 INSERT INTO recipes (
   user_id, title, description, type, asset_id,
@@ -80,7 +246,7 @@ INSERT INTO recipes (
 ) VALUES (
   $1, $2, $3, $4, $5, $6, $7, $8
 )
-RETURNING id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at
+RETURNING id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at, version, comments_count, favorites_count, ratings_count, ratings_sum
 `
 
 type CreateRecipeParams struct {
@@ -118,6 +284,11 @@ func (q *Queries) CreateRecipe(ctx context.Context, arg CreateRecipeParams) (Rec
 		&i.IsPublic,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Version,
+		&i.CommentsCount,
+		&i.FavoritesCount,
+		&i.RatingsCount,
+		&i.RatingsSum,
 	)
 	return i, err
 }
@@ -133,7 +304,7 @@ RETURNING id, email, password_hash, bio, avatar_url, created_at
 
 type CreateUserParams struct {
 	Email        string `json:"email"`
-	PasswordHash string `json:"passwordHash"`
+	PasswordHash string `json:"-"`
 	Bio          string `json:"bio"`
 	AvatarUrl    string `json:"avatarUrl"`
 }
@@ -167,6 +338,64 @@ func (q *Queries) DeleteComment(ctx context.Context, id int32) error {
 	return err
 }
 
+const deleteCommentReaction = `-- name: DeleteCommentReaction :exec
+DELETE FROM comment_reactions
+WHERE comment_id = $1 AND user_id = $2
+`
+
+type DeleteCommentReactionParams struct {
+	CommentID int32 `json:"commentId"`
+	UserID    int32 `json:"userId"`
+}
+
+func (q *Queries) DeleteCommentReaction(ctx context.Context, arg DeleteCommentReactionParams) error {
+	_, err := q.db.Exec(ctx, deleteCommentReaction, arg.CommentID, arg.UserID)
+	return err
+}
+
+const deleteExpiredIdempotencyKeys = `-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredIdempotencyKeys)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteIdempotencyKey = `-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE user_id = $1 AND idempotency_key = $2
+`
+
+type DeleteIdempotencyKeyParams struct {
+	UserID         int32  `json:"userId"`
+	IdempotencyKey string `json:"idempotencyKey"`
+}
+
+func (q *Queries) DeleteIdempotencyKey(ctx context.Context, arg DeleteIdempotencyKeyParams) error {
+	_, err := q.db.Exec(ctx, deleteIdempotencyKey, arg.UserID, arg.IdempotencyKey)
+	return err
+}
+
+const deleteRating = `-- name: DeleteRating :exec
+DELETE FROM ratings
+WHERE user_id = $1 AND recipe_id = $2
+`
+
+type DeleteRatingParams struct {
+	UserID   int32 `json:"userId"`
+	RecipeID int32 `json:"recipeId"`
+}
+
+func (q *Queries) DeleteRating(ctx context.Context, arg DeleteRatingParams) error {
+	_, err := q.db.Exec(ctx, deleteRating, arg.UserID, arg.RecipeID)
+	return err
+}
+
 const deleteRecipe = `-- name: DeleteRecipe :exec
 DELETE FROM recipes
 WHERE id = $1
@@ -177,6 +406,16 @@ func (q *Queries) DeleteRecipe(ctx context.Context, id int32) error {
 	return err
 }
 
+const deleteRecipeIngredients = `-- name: DeleteRecipeIngredients :exec
+DELETE FROM recipe_ingredients
+WHERE recipe_id = $1
+`
+
+func (q *Queries) DeleteRecipeIngredients(ctx context.Context, recipeID int32) error {
+	_, err := q.db.Exec(ctx, deleteRecipeIngredients, recipeID)
+	return err
+}
+
 const deleteRecipeStep = `-- name: DeleteRecipeStep :exec
 DELETE FROM recipe_steps
 WHERE id = $1
@@ -203,8 +442,209 @@ func (q *Queries) FavoriteRecipe(ctx context.Context, arg FavoriteRecipeParams)
 	return err
 }
 
+const filterPublicRecipes = `-- name: FilterPublicRecipes :many
+SELECT r.id, r.user_id, r.title, r.description, r.type, r.asset_id, r.prep_time_minutes, r.servings, r.is_public, r.created_at, r.updated_at, r.version, r.comments_count, r.favorites_count, r.ratings_count, r.ratings_sum FROM recipes r
+WHERE r.is_public = true
+  AND ($1::integer IS NULL OR r.prep_time_minutes <= $1)
+  AND ($2::integer IS NULL OR r.servings >= $2)
+  AND ($3::integer IS NULL OR r.servings <= $3)
+  AND ($4::integer IS NULL OR r.user_id = $4)
+  AND ($5::timestamp IS NULL OR r.created_at > $5)
+  AND ($6::boolean IS NULL OR (r.asset_id <> '') = $6)
+  AND (cardinality($7::integer[]) = 0 OR r.type = ANY($7::integer[]))
+  AND ($8::timestamp IS NULL
+    OR (r.created_at, r.id) < ($8, $9::integer))
+ORDER BY
+  CASE WHEN $10::text = 'favorites' THEN r.favorites_count END DESC,
+  CASE WHEN $10::text = 'comments' THEN r.comments_count END DESC,
+  CASE WHEN $10::text = 'quickest'
+    THEN r.prep_time_minutes END ASC NULLS LAST,
+  CASE WHEN $10::text = 'rating' THEN
+    (r.ratings_sum + $11::float8 * (
+      SELECT COALESCE(sum(ratings_sum)::float8 / NULLIF(sum(ratings_count), 0), 0)
+      FROM recipes
+      WHERE is_public = true
+    )) / (r.ratings_count + $11::float8)
+  END DESC,
+  r.created_at DESC, r.id DESC
+LIMIT $13 OFFSET $12
+`
+
+type FilterPublicRecipesParams struct {
+	MaxPrepTime       pgtype.Int4      `json:"maxPrepTime"`
+	MinServings       pgtype.Int4      `json:"minServings"`
+	MaxServings       pgtype.Int4      `json:"maxServings"`
+	AuthorID          pgtype.Int4      `json:"authorId"`
+	CreatedAfter      pgtype.Timestamp `json:"createdAfter"`
+	HasImage          pgtype.Bool      `json:"hasImage"`
+	TeaTypes          []int32          `json:"teaTypes"`
+	CursorCreatedAt   pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID          pgtype.Int4      `json:"cursorId"`
+	Sort              string           `json:"sort"`
+	RatingPriorWeight float64          `json:"ratingPriorWeight"`
+	PageOffset        int32            `json:"pageOffset"`
+	PageLimit         int32            `json:"pageLimit"`
+}
+
+// Every filter is optional, an empty tea_types matches all tea types. sort is
+// one of newest, favorites, comments, quickest or rating. The cursor only
+// applies to newest, the other orderings page by offset.
+//
+// rating orders by the Bayesian average rating: every recipe starts with
+// rating_prior_weight ratings of the site wide average, so a handful of 5
+// star ratings do not outrank a recipe rated well by many.
+func (q *Queries) FilterPublicRecipes(ctx context.Context, arg FilterPublicRecipesParams) ([]Recipe, error) {
+	rows, err := q.db.Query(ctx, filterPublicRecipes,
+		arg.MaxPrepTime,
+		arg.MinServings,
+		arg.MaxServings,
+		arg.AuthorID,
+		arg.CreatedAfter,
+		arg.HasImage,
+		arg.TeaTypes,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Sort,
+		arg.RatingPriorWeight,
+		arg.PageOffset,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Recipe
+	for rows.Next() {
+		var i Recipe
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Title,
+			&i.Description,
+			&i.Type,
+			&i.AssetID,
+			&i.PrepTimeMinutes,
+			&i.Servings,
+			&i.IsPublic,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Version,
+			&i.CommentsCount,
+			&i.FavoritesCount,
+			&i.RatingsCount,
+			&i.RatingsSum,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const followUser = `-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type FollowUserParams struct {
+	FollowerID int32 `json:"followerId"`
+	FolloweeID int32 `json:"followeeId"`
+}
+
+func (q *Queries) FollowUser(ctx context.Context, arg FollowUserParams) error {
+	_, err := q.db.Exec(ctx, followUser, arg.FollowerID, arg.FolloweeID)
+	return err
+}
+
+const getComment = `-- name: GetComment :one
+SELECT id, recipe_id, user_id, comment, created_at, parent_id, depth, deleted_at, reactions_count FROM recipe_comments
+WHERE id = $1
+`
+
+func (q *Queries) GetComment(ctx context.Context, id int32) (RecipeComment, error) {
+	row := q.db.QueryRow(ctx, getComment, id)
+	var i RecipeComment
+	err := row.Scan(
+		&i.ID,
+		&i.RecipeID,
+		&i.UserID,
+		&i.Comment,
+		&i.CreatedAt,
+		&i.ParentID,
+		&i.Depth,
+		&i.DeletedAt,
+		&i.ReactionsCount,
+	)
+	return i, err
+}
+
+const getCommentForUpdate = `-- name: GetCommentForUpdate :one
+SELECT id, recipe_id, user_id, comment, created_at, parent_id, depth, deleted_at, reactions_count FROM recipe_comments
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetCommentForUpdate(ctx context.Context, id int32) (RecipeComment, error) {
+	row := q.db.QueryRow(ctx, getCommentForUpdate, id)
+	var i RecipeComment
+	err := row.Scan(
+		&i.ID,
+		&i.RecipeID,
+		&i.UserID,
+		&i.Comment,
+		&i.CreatedAt,
+		&i.ParentID,
+		&i.Depth,
+		&i.DeletedAt,
+		&i.ReactionsCount,
+	)
+	return i, err
+}
+
+const getIdempotencyKey = `-- name: GetIdempotencyKey :one
+SELECT user_id, idempotency_key, request_hash, status_code, content_type, response_body, created_at, expires_at FROM idempotency_keys
+WHERE user_id = $1 AND idempotency_key = $2
+`
+
+type GetIdempotencyKeyParams struct {
+	UserID         int32  `json:"userId"`
+	IdempotencyKey string `json:"idempotencyKey"`
+}
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRow(ctx, getIdempotencyKey, arg.UserID, arg.IdempotencyKey)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.UserID,
+		&i.IdempotencyKey,
+		&i.RequestHash,
+		&i.StatusCode,
+		&i.ContentType,
+		&i.ResponseBody,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getLastRecipeStepNumber = `-- name: GetLastRecipeStepNumber :one
+SELECT COALESCE(MAX(step_number), 0)::integer FROM recipe_steps
+WHERE recipe_id = $1
+`
+
+func (q *Queries) GetLastRecipeStepNumber(ctx context.Context, recipeID pgtype.Int4) (int32, error) {
+	row := q.db.QueryRow(ctx, getLastRecipeStepNumber, recipeID)
+	var column_1 int32
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const getRecipe = `-- name: GetRecipe :one
-SELECT id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at FROM recipes
+SELECT id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at, version, comments_count, favorites_count, ratings_count, ratings_sum FROM recipes
 WHERE id = $1
 `
 
@@ -223,6 +663,139 @@ func (q *Queries) GetRecipe(ctx context.Context, id int32) (Recipe, error) {
 		&i.IsPublic,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Version,
+		&i.CommentsCount,
+		&i.FavoritesCount,
+		&i.RatingsCount,
+		&i.RatingsSum,
+	)
+	return i, err
+}
+
+const getRecipeDetail = `-- name: GetRecipeDetail :one
+SELECT
+  r.id, r.user_id, r.title, r.description, r.type, r.asset_id, r.prep_time_minutes, r.servings, r.is_public, r.created_at, r.updated_at, r.version, r.comments_count, r.favorites_count, r.ratings_count, r.ratings_sum,
+  json_build_object(
+    'id', u.id,
+    'email', u.email,
+    'bio', u.bio,
+    'avatarUrl', u.avatar_url,
+    'createdAt', u.created_at AT TIME ZONE 'UTC'
+  )::jsonb AS author,
+  COALESCE((
+    SELECT jsonb_agg(jsonb_build_object(
+      'id', s.id,
+      'stepNumber', s.step_number,
+      'description', s.description,
+      'assetId', s.asset_id
+    ) ORDER BY s.step_number)
+    FROM recipe_steps s
+    WHERE s.recipe_id = r.id
+  ), '[]')::jsonb AS steps,
+  COALESCE((
+    SELECT jsonb_agg(jsonb_build_object(
+      'name', i.name,
+      'quantity', ri.quantity,
+      'unit', ri.unit,
+      'note', ri.note
+    ) ORDER BY ri.position)
+    FROM recipe_ingredients ri
+    JOIN ingredients i ON ri.ingredient_id = i.id
+    WHERE ri.recipe_id = r.id
+  ), '[]')::jsonb AS ingredients,
+  EXISTS (
+    SELECT 1 FROM favorites f
+    WHERE f.recipe_id = r.id AND f.user_id = $1::integer
+  ) AS favorited_by_me,
+  ARRAY(
+    SELECT count(ra.user_id)
+    FROM generate_series(1, 5) AS s (stars)
+    LEFT JOIN ratings ra ON ra.recipe_id = r.id AND ra.stars = s.stars
+    GROUP BY s.stars
+    ORDER BY s.stars
+  )::integer[] AS rating_distribution,
+  COALESCE((
+    SELECT ra.stars FROM ratings ra
+    WHERE ra.recipe_id = r.id AND ra.user_id = $1::integer
+  ), 0)::integer AS my_rating
+FROM recipes r
+JOIN users u ON u.id = r.user_id
+WHERE r.id = $2
+`
+
+type GetRecipeDetailParams struct {
+	ViewerID int32 `json:"viewerId"`
+	ID       int32 `json:"id"`
+}
+
+type GetRecipeDetailRow struct {
+	Recipe             Recipe  `json:"recipe"`
+	Author             []byte  `json:"author"`
+	Steps              []byte  `json:"steps"`
+	Ingredients        []byte  `json:"ingredients"`
+	FavoritedByMe      bool    `json:"favoritedByMe"`
+	RatingDistribution []int32 `json:"ratingDistribution"`
+	MyRating           int32   `json:"myRating"`
+}
+
+// Everything the recipe page shows in one round trip, nested rows are
+// aggregated as JSON.
+func (q *Queries) GetRecipeDetail(ctx context.Context, arg GetRecipeDetailParams) (GetRecipeDetailRow, error) {
+	row := q.db.QueryRow(ctx, getRecipeDetail, arg.ViewerID, arg.ID)
+	var i GetRecipeDetailRow
+	err := row.Scan(
+		&i.Recipe.ID,
+		&i.Recipe.UserID,
+		&i.Recipe.Title,
+		&i.Recipe.Description,
+		&i.Recipe.Type,
+		&i.Recipe.AssetID,
+		&i.Recipe.PrepTimeMinutes,
+		&i.Recipe.Servings,
+		&i.Recipe.IsPublic,
+		&i.Recipe.CreatedAt,
+		&i.Recipe.UpdatedAt,
+		&i.Recipe.Version,
+		&i.Recipe.CommentsCount,
+		&i.Recipe.FavoritesCount,
+		&i.Recipe.RatingsCount,
+		&i.Recipe.RatingsSum,
+		&i.Author,
+		&i.Steps,
+		&i.Ingredients,
+		&i.FavoritedByMe,
+		&i.RatingDistribution,
+		&i.MyRating,
+	)
+	return i, err
+}
+
+const getRecipeForUpdate = `-- name: GetRecipeForUpdate :one
+SELECT id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at, version, comments_count, favorites_count, ratings_count, ratings_sum FROM recipes
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetRecipeForUpdate(ctx context.Context, id int32) (Recipe, error) {
+	row := q.db.QueryRow(ctx, getRecipeForUpdate, id)
+	var i Recipe
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Title,
+		&i.Description,
+		&i.Type,
+		&i.AssetID,
+		&i.PrepTimeMinutes,
+		&i.Servings,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.CommentsCount,
+		&i.FavoritesCount,
+		&i.RatingsCount,
+		&i.RatingsSum,
 	)
 	return i, err
 }
@@ -338,6 +911,20 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 	return i, err
 }
 
+const hasCommentReplies = `-- name: HasCommentReplies :one
+SELECT EXISTS (
+  SELECT 1 FROM recipe_comments
+  WHERE parent_id = $1
+) AS has_replies
+`
+
+func (q *Queries) HasCommentReplies(ctx context.Context, parentID pgtype.Int4) (bool, error) {
+	row := q.db.QueryRow(ctx, hasCommentReplies, parentID)
+	var has_replies bool
+	err := row.Scan(&has_replies)
+	return has_replies, err
+}
+
 const isRecipeFavorited = `-- name: IsRecipeFavorited :one
 SELECT EXISTS (
   SELECT 1 FROM favorites
@@ -357,35 +944,83 @@ func (q *Queries) IsRecipeFavorited(ctx context.Context, arg IsRecipeFavoritedPa
 	return favorited, err
 }
 
-const listComments = `-- name: ListComments :many
-SELECT rc.comment, rc.created_at, u.email, u.avatar_url
+const listCommentReplies = `-- name: ListCommentReplies :many
+SELECT
+  rc.id, rc.recipe_id, rc.user_id, rc.comment, rc.created_at, rc.parent_id, rc.depth, rc.deleted_at, rc.reactions_count,
+  u.id, u.email, u.password_hash, u.bio, u.avatar_url, u.created_at,
+  (SELECT count(*) FROM recipe_comments r WHERE r.parent_id = rc.id)::integer AS reply_count,
+  COALESCE((
+    SELECT jsonb_object_agg(cr.reaction, cr.n)
+    FROM (
+      SELECT reaction, count(*) AS n FROM comment_reactions
+      WHERE comment_id = rc.id
+      GROUP BY reaction
+    ) cr
+  ), '{}')::jsonb AS reactions,
+  COALESCE((
+    SELECT reaction FROM comment_reactions
+    WHERE comment_id = rc.id AND user_id = $1::integer
+  ), '')::text AS my_reaction
 FROM recipe_comments rc
 JOIN users u ON rc.user_id = u.id
-WHERE rc.recipe_id = $1
-ORDER BY rc.created_at DESC
+WHERE rc.parent_id = $2
+  AND ($3::timestamp IS NULL
+    OR (rc.created_at, rc.id) > ($3, $4::integer))
+ORDER BY rc.created_at, rc.id
+LIMIT $5
 `
 
-type ListCommentsRow struct {
-	Comment   string           `json:"comment"`
-	CreatedAt pgtype.Timestamp `json:"createdAt"`
-	Email     string           `json:"email"`
-	AvatarUrl string           `json:"avatarUrl"`
+type ListCommentRepliesParams struct {
+	ViewerID        int32            `json:"viewerId"`
+	ParentID        pgtype.Int4      `json:"parentId"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+	PageLimit       int32            `json:"pageLimit"`
+}
+
+type ListCommentRepliesRow struct {
+	RecipeComment RecipeComment `json:"recipeComment"`
+	User          User          `json:"user"`
+	ReplyCount    int32         `json:"replyCount"`
+	Reactions     []byte        `json:"reactions"`
+	MyReaction    string        `json:"myReaction"`
 }
 
-func (q *Queries) ListComments(ctx context.Context, recipeID pgtype.Int4) ([]ListCommentsRow, error) {
-	rows, err := q.db.Query(ctx, listComments, recipeID)
+// Direct replies to a comment, oldest first so threads read in order.
+func (q *Queries) ListCommentReplies(ctx context.Context, arg ListCommentRepliesParams) ([]ListCommentRepliesRow, error) {
+	rows, err := q.db.Query(ctx, listCommentReplies,
+		arg.ViewerID,
+		arg.ParentID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ListCommentsRow
+	var items []ListCommentRepliesRow
 	for rows.Next() {
-		var i ListCommentsRow
+		var i ListCommentRepliesRow
 		if err := rows.Scan(
-			&i.Comment,
-			&i.CreatedAt,
-			&i.Email,
-			&i.AvatarUrl,
+			&i.RecipeComment.ID,
+			&i.RecipeComment.RecipeID,
+			&i.RecipeComment.UserID,
+			&i.RecipeComment.Comment,
+			&i.RecipeComment.CreatedAt,
+			&i.RecipeComment.ParentID,
+			&i.RecipeComment.Depth,
+			&i.RecipeComment.DeletedAt,
+			&i.RecipeComment.ReactionsCount,
+			&i.User.ID,
+			&i.User.Email,
+			&i.User.PasswordHash,
+			&i.User.Bio,
+			&i.User.AvatarUrl,
+			&i.User.CreatedAt,
+			&i.ReplyCount,
+			&i.Reactions,
+			&i.MyReaction,
 		); err != nil {
 			return nil, err
 		}
@@ -397,27 +1032,92 @@ func (q *Queries) ListComments(ctx context.Context, recipeID pgtype.Int4) ([]Lis
 	return items, nil
 }
 
-const listCommentsByUser = `-- name: ListCommentsByUser :many
-SELECT id, recipe_id, user_id, comment, created_at FROM recipe_comments
-WHERE user_id = $1
-ORDER BY created_at DESC
+const listComments = `-- name: ListComments :many
+SELECT
+  rc.id, rc.recipe_id, rc.user_id, rc.comment, rc.created_at, rc.parent_id, rc.depth, rc.deleted_at, rc.reactions_count,
+  u.id, u.email, u.password_hash, u.bio, u.avatar_url, u.created_at,
+  (SELECT count(*) FROM recipe_comments r WHERE r.parent_id = rc.id)::integer AS reply_count,
+  COALESCE((
+    SELECT jsonb_object_agg(cr.reaction, cr.n)
+    FROM (
+      SELECT reaction, count(*) AS n FROM comment_reactions
+      WHERE comment_id = rc.id
+      GROUP BY reaction
+    ) cr
+  ), '{}')::jsonb AS reactions,
+  COALESCE((
+    SELECT reaction FROM comment_reactions
+    WHERE comment_id = rc.id AND user_id = $1::integer
+  ), '')::text AS my_reaction
+FROM recipe_comments rc
+JOIN users u ON rc.user_id = u.id
+WHERE rc.recipe_id = $2
+  AND rc.parent_id IS NULL
+  AND ($3::timestamp IS NULL
+    OR (rc.created_at, rc.id) < ($3, $4::integer))
+ORDER BY
+  CASE WHEN $5::text = 'top' THEN rc.reactions_count END DESC,
+  rc.created_at DESC, rc.id DESC
+LIMIT $7 OFFSET $6
 `
 
-func (q *Queries) ListCommentsByUser(ctx context.Context, userID pgtype.Int4) ([]RecipeComment, error) {
-	rows, err := q.db.Query(ctx, listCommentsByUser, userID)
+type ListCommentsParams struct {
+	ViewerID        int32            `json:"viewerId"`
+	RecipeID        pgtype.Int4      `json:"recipeId"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+	Sort            string           `json:"sort"`
+	PageOffset      int32            `json:"pageOffset"`
+	PageLimit       int32            `json:"pageLimit"`
+}
+
+type ListCommentsRow struct {
+	RecipeComment RecipeComment `json:"recipeComment"`
+	User          User          `json:"user"`
+	ReplyCount    int32         `json:"replyCount"`
+	Reactions     []byte        `json:"reactions"`
+	MyReaction    string        `json:"myReaction"`
+}
+
+// Top level comments of the recipe with their number of direct replies, their
+// reaction counts and the viewer's reaction. sort is newest or top, the
+// cursor only applies to newest, top pages by offset.
+func (q *Queries) ListComments(ctx context.Context, arg ListCommentsParams) ([]ListCommentsRow, error) {
+	rows, err := q.db.Query(ctx, listComments,
+		arg.ViewerID,
+		arg.RecipeID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Sort,
+		arg.PageOffset,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []RecipeComment
+	var items []ListCommentsRow
 	for rows.Next() {
-		var i RecipeComment
+		var i ListCommentsRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.RecipeID,
-			&i.UserID,
-			&i.Comment,
-			&i.CreatedAt,
+			&i.RecipeComment.ID,
+			&i.RecipeComment.RecipeID,
+			&i.RecipeComment.UserID,
+			&i.RecipeComment.Comment,
+			&i.RecipeComment.CreatedAt,
+			&i.RecipeComment.ParentID,
+			&i.RecipeComment.Depth,
+			&i.RecipeComment.DeletedAt,
+			&i.RecipeComment.ReactionsCount,
+			&i.User.ID,
+			&i.User.Email,
+			&i.User.PasswordHash,
+			&i.User.Bio,
+			&i.User.AvatarUrl,
+			&i.User.CreatedAt,
+			&i.ReplyCount,
+			&i.Reactions,
+			&i.MyReaction,
 		); err != nil {
 			return nil, err
 		}
@@ -429,14 +1129,348 @@ func (q *Queries) ListCommentsByUser(ctx context.Context, userID pgtype.Int4) ([
 	return items, nil
 }
 
-const listPublicRecipes = `-- name: ListPublicRecipes :many
-SELECT id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at FROM recipes
-WHERE is_public = true
-ORDER BY created_at DESC
+const listCommentsByUser = `-- name: ListCommentsByUser :many
+SELECT
+  rc.id, rc.recipe_id, rc.user_id, rc.comment, rc.created_at, rc.parent_id, rc.depth, rc.deleted_at, rc.reactions_count,
+  u.id, u.email, u.password_hash, u.bio, u.avatar_url, u.created_at,
+  (SELECT count(*) FROM recipe_comments r WHERE r.parent_id = rc.id)::integer AS reply_count,
+  COALESCE((
+    SELECT jsonb_object_agg(cr.reaction, cr.n)
+    FROM (
+      SELECT reaction, count(*) AS n FROM comment_reactions
+      WHERE comment_id = rc.id
+      GROUP BY reaction
+    ) cr
+  ), '{}')::jsonb AS reactions,
+  COALESCE((
+    SELECT reaction FROM comment_reactions
+    WHERE comment_id = rc.id AND user_id = $1::integer
+  ), '')::text AS my_reaction
+FROM recipe_comments rc
+JOIN users u ON rc.user_id = u.id
+WHERE rc.user_id = $2
+  AND rc.deleted_at IS NULL
+  AND ($3::timestamp IS NULL
+    OR (rc.created_at, rc.id) < ($3, $4::integer))
+ORDER BY rc.created_at DESC, rc.id DESC
+LIMIT $5
 `
 
-func (q *Queries) ListPublicRecipes(ctx context.Context) ([]Recipe, error) {
-	rows, err := q.db.Query(ctx, listPublicRecipes)
+type ListCommentsByUserParams struct {
+	ViewerID        int32            `json:"viewerId"`
+	UserID          pgtype.Int4      `json:"userId"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+	PageLimit       int32            `json:"pageLimit"`
+}
+
+type ListCommentsByUserRow struct {
+	RecipeComment RecipeComment `json:"recipeComment"`
+	User          User          `json:"user"`
+	ReplyCount    int32         `json:"replyCount"`
+	Reactions     []byte        `json:"reactions"`
+	MyReaction    string        `json:"myReaction"`
+}
+
+func (q *Queries) ListCommentsByUser(ctx context.Context, arg ListCommentsByUserParams) ([]ListCommentsByUserRow, error) {
+	rows, err := q.db.Query(ctx, listCommentsByUser,
+		arg.ViewerID,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListCommentsByUserRow
+	for rows.Next() {
+		var i ListCommentsByUserRow
+		if err := rows.Scan(
+			&i.RecipeComment.ID,
+			&i.RecipeComment.RecipeID,
+			&i.RecipeComment.UserID,
+			&i.RecipeComment.Comment,
+			&i.RecipeComment.CreatedAt,
+			&i.RecipeComment.ParentID,
+			&i.RecipeComment.Depth,
+			&i.RecipeComment.DeletedAt,
+			&i.RecipeComment.ReactionsCount,
+			&i.User.ID,
+			&i.User.Email,
+			&i.User.PasswordHash,
+			&i.User.Bio,
+			&i.User.AvatarUrl,
+			&i.User.CreatedAt,
+			&i.ReplyCount,
+			&i.Reactions,
+			&i.MyReaction,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFavoritedRecipeIds = `-- name: ListFavoritedRecipeIds :many
+SELECT recipe_id FROM favorites
+WHERE user_id = $1 AND recipe_id = ANY($2::integer[])
+`
+
+type ListFavoritedRecipeIdsParams struct {
+	UserID    int32   `json:"userId"`
+	RecipeIds []int32 `json:"recipeIds"`
+}
+
+// Which of recipe_ids the user has favorited.
+func (q *Queries) ListFavoritedRecipeIds(ctx context.Context, arg ListFavoritedRecipeIdsParams) ([]int32, error) {
+	rows, err := q.db.Query(ctx, listFavoritedRecipeIds, arg.UserID, arg.RecipeIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var recipe_id int32
+		if err := rows.Scan(&recipe_id); err != nil {
+			return nil, err
+		}
+		items = append(items, recipe_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFeed = `-- name: ListFeed :many
+WITH followed AS (
+  SELECT followee_id FROM follows WHERE follower_id = $2
+), popular AS (
+  SELECT recipe_id AS id FROM trending_recipes
+  WHERE window_name = $3
+  ORDER BY score DESC, recipe_id DESC
+  LIMIT $4
+), feed AS (
+  SELECT fr.id, true AS from_following
+  FROM followed f
+  CROSS JOIN LATERAL (
+    SELECT r.id FROM recipes r
+    WHERE r.user_id = f.followee_id
+      AND r.is_public = true
+      AND ($5::timestamp IS NULL
+        OR (r.created_at, r.id) < ($5, $6::integer))
+    ORDER BY r.created_at DESC, r.id DESC
+    LIMIT $1
+  ) fr
+  UNION ALL
+  (
+    SELECT r.id, false AS from_following
+    FROM popular p
+    JOIN recipes r ON r.id = p.id
+    WHERE r.is_public = true
+      AND r.user_id NOT IN (SELECT followee_id FROM followed)
+      AND ($5::timestamp IS NULL
+        OR (r.created_at, r.id) < ($5, $6::integer))
+    ORDER BY r.created_at DESC, r.id DESC
+    LIMIT $1
+  )
+)
+SELECT r.id, r.user_id, r.title, r.description, r.type, r.asset_id, r.prep_time_minutes, r.servings, r.is_public, r.created_at, r.updated_at, r.version, r.comments_count, r.favorites_count, r.ratings_count, r.ratings_sum, feed.from_following::boolean AS from_following
+FROM feed
+JOIN recipes r ON r.id = feed.id
+ORDER BY r.created_at DESC, r.id DESC
+LIMIT $1
+`
+
+type ListFeedParams struct {
+	PageLimit       int32            `json:"pageLimit"`
+	UserID          int32            `json:"userId"`
+	TrendingWindow  string           `json:"trendingWindow"`
+	PopularLimit    int32            `json:"popularLimit"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+}
+
+type ListFeedRow struct {
+	Recipe        Recipe `json:"recipe"`
+	FromFollowing bool   `json:"fromFollowing"`
+}
+
+// Public recipes from followed users, newest first, mixed with the top
+// trending recipes. Each branch applies the cursor and limit on its own so
+// followed authors are read through idx_recipes_user_id_created_at, the
+// branches don't overlap so UNION ALL skips the dedupe.
+func (q *Queries) ListFeed(ctx context.Context, arg ListFeedParams) ([]ListFeedRow, error) {
+	rows, err := q.db.Query(ctx, listFeed,
+		arg.PageLimit,
+		arg.UserID,
+		arg.TrendingWindow,
+		arg.PopularLimit,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFeedRow
+	for rows.Next() {
+		var i ListFeedRow
+		if err := rows.Scan(
+			&i.Recipe.ID,
+			&i.Recipe.UserID,
+			&i.Recipe.Title,
+			&i.Recipe.Description,
+			&i.Recipe.Type,
+			&i.Recipe.AssetID,
+			&i.Recipe.PrepTimeMinutes,
+			&i.Recipe.Servings,
+			&i.Recipe.IsPublic,
+			&i.Recipe.CreatedAt,
+			&i.Recipe.UpdatedAt,
+			&i.Recipe.Version,
+			&i.Recipe.CommentsCount,
+			&i.Recipe.FavoritesCount,
+			&i.Recipe.RatingsCount,
+			&i.Recipe.RatingsSum,
+			&i.FromFollowing,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFollowers = `-- name: ListFollowers :many
+SELECT u.id, u.email, u.password_hash, u.bio, u.avatar_url, u.created_at, f.created_at AS followed_at
+FROM follows f
+JOIN users u ON u.id = f.follower_id
+WHERE f.followee_id = $1
+  AND ($2::timestamp IS NULL
+    OR (f.created_at, u.id) < ($2, $3::integer))
+ORDER BY f.created_at DESC, u.id DESC
+LIMIT $4
+`
+
+type ListFollowersParams struct {
+	UserID          int32            `json:"userId"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+	PageLimit       int32            `json:"pageLimit"`
+}
+
+type ListFollowersRow struct {
+	User       User             `json:"user"`
+	FollowedAt pgtype.Timestamp `json:"followedAt"`
+}
+
+func (q *Queries) ListFollowers(ctx context.Context, arg ListFollowersParams) ([]ListFollowersRow, error) {
+	rows, err := q.db.Query(ctx, listFollowers,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFollowersRow
+	for rows.Next() {
+		var i ListFollowersRow
+		if err := rows.Scan(
+			&i.User.ID,
+			&i.User.Email,
+			&i.User.PasswordHash,
+			&i.User.Bio,
+			&i.User.AvatarUrl,
+			&i.User.CreatedAt,
+			&i.FollowedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFollowing = `-- name: ListFollowing :many
+SELECT u.id, u.email, u.password_hash, u.bio, u.avatar_url, u.created_at, f.created_at AS followed_at
+FROM follows f
+JOIN users u ON u.id = f.followee_id
+WHERE f.follower_id = $1
+  AND ($2::timestamp IS NULL
+    OR (f.created_at, u.id) < ($2, $3::integer))
+ORDER BY f.created_at DESC, u.id DESC
+LIMIT $4
+`
+
+type ListFollowingParams struct {
+	UserID          int32            `json:"userId"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+	PageLimit       int32            `json:"pageLimit"`
+}
+
+type ListFollowingRow struct {
+	User       User             `json:"user"`
+	FollowedAt pgtype.Timestamp `json:"followedAt"`
+}
+
+func (q *Queries) ListFollowing(ctx context.Context, arg ListFollowingParams) ([]ListFollowingRow, error) {
+	rows, err := q.db.Query(ctx, listFollowing,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFollowingRow
+	for rows.Next() {
+		var i ListFollowingRow
+		if err := rows.Scan(
+			&i.User.ID,
+			&i.User.Email,
+			&i.User.PasswordHash,
+			&i.User.Bio,
+			&i.User.AvatarUrl,
+			&i.User.CreatedAt,
+			&i.FollowedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPublicRecipes = `-- name: ListPublicRecipes :many
+SELECT id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at, version, comments_count, favorites_count, ratings_count, ratings_sum FROM recipes
+WHERE is_public = true
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListPublicRecipes(ctx context.Context) ([]Recipe, error) {
+	rows, err := q.db.Query(ctx, listPublicRecipes)
 	if err != nil {
 		return nil, err
 	}
@@ -456,6 +1490,11 @@ func (q *Queries) ListPublicRecipes(ctx context.Context) ([]Recipe, error) {
 			&i.IsPublic,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Version,
+			&i.CommentsCount,
+			&i.FavoritesCount,
+			&i.RatingsCount,
+			&i.RatingsSum,
 		); err != nil {
 			return nil, err
 		}
@@ -467,39 +1506,102 @@ func (q *Queries) ListPublicRecipes(ctx context.Context) ([]Recipe, error) {
 	return items, nil
 }
 
-const listPublicRecipesPaginated = `-- name: ListPublicRecipesPaginated :many
-SELECT id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at FROM recipes
-WHERE is_public = true
-ORDER BY created_at DESC
-LIMIT $1 OFFSET $2
+const listRecipeIngredients = `-- name: ListRecipeIngredients :many
+SELECT ri.id, ri.position, i.name, ri.quantity, ri.unit, ri.note
+FROM recipe_ingredients ri
+JOIN ingredients i ON ri.ingredient_id = i.id
+WHERE ri.recipe_id = $1
+ORDER BY ri.position
 `
 
-type ListPublicRecipesPaginatedParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+type ListRecipeIngredientsRow struct {
+	ID       int32         `json:"id"`
+	Position int32         `json:"position"`
+	Name     string        `json:"name"`
+	Quantity pgtype.Float8 `json:"quantity"`
+	Unit     pgtype.Text   `json:"unit"`
+	Note     pgtype.Text   `json:"note"`
 }
 
-func (q *Queries) ListPublicRecipesPaginated(ctx context.Context, arg ListPublicRecipesPaginatedParams) ([]Recipe, error) {
-	rows, err := q.db.Query(ctx, listPublicRecipesPaginated, arg.Limit, arg.Offset)
+func (q *Queries) ListRecipeIngredients(ctx context.Context, recipeID int32) ([]ListRecipeIngredientsRow, error) {
+	rows, err := q.db.Query(ctx, listRecipeIngredients, recipeID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Recipe
+	var items []ListRecipeIngredientsRow
 	for rows.Next() {
-		var i Recipe
+		var i ListRecipeIngredientsRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.UserID,
-			&i.Title,
-			&i.Description,
-			&i.Type,
-			&i.AssetID,
-			&i.PrepTimeMinutes,
-			&i.Servings,
-			&i.IsPublic,
-			&i.CreatedAt,
-			&i.UpdatedAt,
+			&i.Position,
+			&i.Name,
+			&i.Quantity,
+			&i.Unit,
+			&i.Note,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecipeReviews = `-- name: ListRecipeReviews :many
+SELECT ra.user_id, ra.recipe_id, ra.stars, ra.review, ra.created_at, ra.updated_at, u.id, u.email, u.password_hash, u.bio, u.avatar_url, u.created_at
+FROM ratings ra
+JOIN users u ON u.id = ra.user_id
+WHERE ra.recipe_id = $1
+  AND ra.review IS NOT NULL
+  AND ($2::timestamp IS NULL
+    OR (ra.updated_at, ra.user_id) < ($2, $3::integer))
+ORDER BY ra.updated_at DESC, ra.user_id DESC
+LIMIT $4
+`
+
+type ListRecipeReviewsParams struct {
+	RecipeID        int32            `json:"recipeId"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+	PageLimit       int32            `json:"pageLimit"`
+}
+
+type ListRecipeReviewsRow struct {
+	Rating Rating `json:"rating"`
+	User   User   `json:"user"`
+}
+
+// Ratings of the recipe that come with a review, most recently updated first.
+func (q *Queries) ListRecipeReviews(ctx context.Context, arg ListRecipeReviewsParams) ([]ListRecipeReviewsRow, error) {
+	rows, err := q.db.Query(ctx, listRecipeReviews,
+		arg.RecipeID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRecipeReviewsRow
+	for rows.Next() {
+		var i ListRecipeReviewsRow
+		if err := rows.Scan(
+			&i.Rating.UserID,
+			&i.Rating.RecipeID,
+			&i.Rating.Stars,
+			&i.Rating.Review,
+			&i.Rating.CreatedAt,
+			&i.Rating.UpdatedAt,
+			&i.User.ID,
+			&i.User.Email,
+			&i.User.PasswordHash,
+			&i.User.Bio,
+			&i.User.AvatarUrl,
+			&i.User.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -543,16 +1645,169 @@ func (q *Queries) ListRecipeSteps(ctx context.Context, recipeID pgtype.Int4) ([]
 	return items, nil
 }
 
+const listTrendingRecipes = `-- name: ListTrendingRecipes :many
+SELECT r.id, r.user_id, r.title, r.description, r.type, r.asset_id, r.prep_time_minutes, r.servings, r.is_public, r.created_at, r.updated_at, r.version, r.comments_count, r.favorites_count, r.ratings_count, r.ratings_sum, t.score
+FROM trending_recipes t
+JOIN recipes r ON r.id = t.recipe_id
+WHERE t.window_name = $1
+  AND r.is_public = true
+  AND ($2::integer IS NULL OR t.tea_type = $2)
+ORDER BY t.score DESC, r.id DESC
+LIMIT $4 OFFSET $3
+`
+
+type ListTrendingRecipesParams struct {
+	WindowName string      `json:"windowName"`
+	TeaType    pgtype.Int4 `json:"teaType"`
+	PageOffset int32       `json:"pageOffset"`
+	PageLimit  int32       `json:"pageLimit"`
+}
+
+type ListTrendingRecipesRow struct {
+	Recipe Recipe  `json:"recipe"`
+	Score  float64 `json:"score"`
+}
+
+func (q *Queries) ListTrendingRecipes(ctx context.Context, arg ListTrendingRecipesParams) ([]ListTrendingRecipesRow, error) {
+	rows, err := q.db.Query(ctx, listTrendingRecipes,
+		arg.WindowName,
+		arg.TeaType,
+		arg.PageOffset,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTrendingRecipesRow
+	for rows.Next() {
+		var i ListTrendingRecipesRow
+		if err := rows.Scan(
+			&i.Recipe.ID,
+			&i.Recipe.UserID,
+			&i.Recipe.Title,
+			&i.Recipe.Description,
+			&i.Recipe.Type,
+			&i.Recipe.AssetID,
+			&i.Recipe.PrepTimeMinutes,
+			&i.Recipe.Servings,
+			&i.Recipe.IsPublic,
+			&i.Recipe.CreatedAt,
+			&i.Recipe.UpdatedAt,
+			&i.Recipe.Version,
+			&i.Recipe.CommentsCount,
+			&i.Recipe.FavoritesCount,
+			&i.Recipe.RatingsCount,
+			&i.Recipe.RatingsSum,
+			&i.Score,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUserFavorites = `-- name: ListUserFavorites :many
-SELECT r.id, r.user_id, r.title, r.description, r.type, r.asset_id, r.prep_time_minutes, r.servings, r.is_public, r.created_at, r.updated_at
+SELECT r.id, r.user_id, r.title, r.description, r.type, r.asset_id, r.prep_time_minutes, r.servings, r.is_public, r.created_at, r.updated_at, r.version, r.comments_count, r.favorites_count, r.ratings_count, r.ratings_sum, f.created_at AS favorited_at
 FROM favorites f
 JOIN recipes r ON f.recipe_id = r.id
 WHERE f.user_id = $1
-ORDER BY f.created_at DESC
+  AND (r.is_public OR r.user_id = $2::integer)
+  AND ($3::timestamp IS NULL
+    OR (f.created_at, r.id) < ($3, $4::integer))
+ORDER BY f.created_at DESC, r.id DESC
+LIMIT $5
 `
 
-func (q *Queries) ListUserFavorites(ctx context.Context, userID int32) ([]Recipe, error) {
-	rows, err := q.db.Query(ctx, listUserFavorites, userID)
+type ListUserFavoritesParams struct {
+	UserID          int32            `json:"userId"`
+	ViewerID        int32            `json:"viewerId"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+	PageLimit       int32            `json:"pageLimit"`
+}
+
+type ListUserFavoritesRow struct {
+	Recipe      Recipe           `json:"recipe"`
+	FavoritedAt pgtype.Timestamp `json:"favoritedAt"`
+}
+
+// Private recipes are left out unless the viewer wrote them.
+func (q *Queries) ListUserFavorites(ctx context.Context, arg ListUserFavoritesParams) ([]ListUserFavoritesRow, error) {
+	rows, err := q.db.Query(ctx, listUserFavorites,
+		arg.UserID,
+		arg.ViewerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserFavoritesRow
+	for rows.Next() {
+		var i ListUserFavoritesRow
+		if err := rows.Scan(
+			&i.Recipe.ID,
+			&i.Recipe.UserID,
+			&i.Recipe.Title,
+			&i.Recipe.Description,
+			&i.Recipe.Type,
+			&i.Recipe.AssetID,
+			&i.Recipe.PrepTimeMinutes,
+			&i.Recipe.Servings,
+			&i.Recipe.IsPublic,
+			&i.Recipe.CreatedAt,
+			&i.Recipe.UpdatedAt,
+			&i.Recipe.Version,
+			&i.Recipe.CommentsCount,
+			&i.Recipe.FavoritesCount,
+			&i.Recipe.RatingsCount,
+			&i.Recipe.RatingsSum,
+			&i.FavoritedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserRecipes = `-- name: ListUserRecipes :many
+SELECT id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at, version, comments_count, favorites_count, ratings_count, ratings_sum FROM recipes
+WHERE user_id = $1
+  AND (is_public OR user_id = $2::integer)
+  AND ($3::timestamp IS NULL
+    OR (created_at, id) < ($3, $4::integer))
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type ListUserRecipesParams struct {
+	UserID          pgtype.Int4      `json:"userId"`
+	ViewerID        int32            `json:"viewerId"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursorCreatedAt"`
+	CursorID        pgtype.Int4      `json:"cursorId"`
+	PageLimit       int32            `json:"pageLimit"`
+}
+
+// Private recipes are only listed to their author.
+func (q *Queries) ListUserRecipes(ctx context.Context, arg ListUserRecipesParams) ([]Recipe, error) {
+	rows, err := q.db.Query(ctx, listUserRecipes,
+		arg.UserID,
+		arg.ViewerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -572,6 +1827,11 @@ func (q *Queries) ListUserFavorites(ctx context.Context, userID int32) ([]Recipe
 			&i.IsPublic,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Version,
+			&i.CommentsCount,
+			&i.FavoritesCount,
+			&i.RatingsCount,
+			&i.RatingsSum,
 		); err != nil {
 			return nil, err
 		}
@@ -583,33 +1843,387 @@ func (q *Queries) ListUserFavorites(ctx context.Context, userID int32) ([]Recipe
 	return items, nil
 }
 
-const listUserRecipes = `-- name: ListUserRecipes :many
-SELECT id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at FROM recipes
-WHERE user_id = $1
-ORDER BY created_at DESC
+const lockDriftedCommentReactionCounts = `-- name: LockDriftedCommentReactionCounts :many
+SELECT rc.id FROM recipe_comments rc
+WHERE rc.reactions_count <> (SELECT count(*) FROM comment_reactions cr WHERE cr.comment_id = rc.id)
+FOR UPDATE
 `
 
-func (q *Queries) ListUserRecipes(ctx context.Context, userID pgtype.Int4) ([]Recipe, error) {
-	rows, err := q.db.Query(ctx, listUserRecipes, userID)
+// Locks the comments whose reaction counters drifted, see
+// LockDriftedRecipeCounters.
+func (q *Queries) LockDriftedCommentReactionCounts(ctx context.Context) ([]int32, error) {
+	rows, err := q.db.Query(ctx, lockDriftedCommentReactionCounts)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Recipe
+	var items []int32
 	for rows.Next() {
-		var i Recipe
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockDriftedRecipeCounters = `-- name: LockDriftedRecipeCounters :many
+SELECT r.id FROM recipes r
+WHERE r.comments_count <> (SELECT count(*) FROM recipe_comments rc WHERE rc.recipe_id = r.id AND rc.deleted_at IS NULL)
+  OR r.favorites_count <> (SELECT count(*) FROM favorites f WHERE f.recipe_id = r.id)
+  OR r.ratings_count <> (SELECT count(*) FROM ratings ra WHERE ra.recipe_id = r.id)
+  OR r.ratings_sum <> (SELECT COALESCE(sum(stars), 0) FROM ratings ra WHERE ra.recipe_id = r.id)
+FOR UPDATE
+`
+
+// Locks the recipes whose counters drifted from the rows they count, so
+// ReconcileRecipeCounters can recount them without racing the triggers.
+func (q *Queries) LockDriftedRecipeCounters(ctx context.Context) ([]int32, error) {
+	rows, err := q.db.Query(ctx, lockDriftedRecipeCounters)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const patchRecipe = `-- name: PatchRecipe :one
+UPDATE recipes SET
+  title = COALESCE($1::varchar, title),
+  description = COALESCE($2::text, description),
+  type = COALESCE($3::integer, type),
+  asset_id = COALESCE($4::text, asset_id),
+  prep_time_minutes = CASE WHEN $5::boolean
+    THEN $6::integer ELSE prep_time_minutes END,
+  servings = CASE WHEN $7::boolean
+    THEN $8::integer ELSE servings END,
+  is_public = COALESCE($9::boolean, is_public),
+  updated_at = NOW(),
+  version = version + 1
+WHERE id = $10
+RETURNING id, user_id, title, description, type, asset_id, prep_time_minutes, servings, is_public, created_at, updated_at, version, comments_count, favorites_count, ratings_count, ratings_sum
+`
+
+type PatchRecipeParams struct {
+	Title              pgtype.Text `json:"title"`
+	Description        pgtype.Text `json:"description"`
+	Type               pgtype.Int4 `json:"type"`
+	AssetID            pgtype.Text `json:"assetId"`
+	SetPrepTimeMinutes bool        `json:"setPrepTimeMinutes"`
+	PrepTimeMinutes    pgtype.Int4 `json:"prepTimeMinutes"`
+	SetServings        bool        `json:"setServings"`
+	Servings           pgtype.Int4 `json:"servings"`
+	IsPublic           pgtype.Bool `json:"isPublic"`
+	ID                 int32       `json:"id"`
+}
+
+// Only touches columns whose params are set. Nullable columns have an explicit
+// set_ flag so a patch can clear them.
+func (q *Queries) PatchRecipe(ctx context.Context, arg PatchRecipeParams) (Recipe, error) {
+	row := q.db.QueryRow(ctx, patchRecipe,
+		arg.Title,
+		arg.Description,
+		arg.Type,
+		arg.AssetID,
+		arg.SetPrepTimeMinutes,
+		arg.PrepTimeMinutes,
+		arg.SetServings,
+		arg.Servings,
+		arg.IsPublic,
+		arg.ID,
+	)
+	var i Recipe
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Title,
+		&i.Description,
+		&i.Type,
+		&i.AssetID,
+		&i.PrepTimeMinutes,
+		&i.Servings,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.CommentsCount,
+		&i.FavoritesCount,
+		&i.RatingsCount,
+		&i.RatingsSum,
+	)
+	return i, err
+}
+
+const rankTrendingRecipes = `-- name: RankTrendingRecipes :execrows
+INSERT INTO trending_recipes (window_name, recipe_id, tea_type, score)
+SELECT $1::text, ranked.id, ranked.type, ranked.score
+FROM (
+  SELECT
+    r.id,
+    r.type,
+    (2 * COALESCE(f.n, 0) + COALESCE(c.n, 0))
+      / power(EXTRACT(EPOCH FROM NOW() - r.created_at) / 3600 + 2, $2::float8) AS score,
+    row_number() OVER (
+      PARTITION BY r.type
+      ORDER BY (2 * COALESCE(f.n, 0) + COALESCE(c.n, 0))
+        / power(EXTRACT(EPOCH FROM NOW() - r.created_at) / 3600 + 2, $2::float8) DESC
+    ) AS position
+  FROM recipes r
+  LEFT JOIN (
+    SELECT recipe_id, count(*) AS n FROM favorites
+    WHERE created_at > NOW() - make_interval(secs => $3::float8)
+    GROUP BY recipe_id
+  ) f ON f.recipe_id = r.id
+  LEFT JOIN (
+    SELECT recipe_id, count(*) AS n FROM recipe_comments
+    WHERE deleted_at IS NULL
+      AND created_at > NOW() - make_interval(secs => $3::float8)
+    GROUP BY recipe_id
+  ) c ON c.recipe_id = r.id
+  WHERE r.is_public = true
+    AND r.created_at IS NOT NULL
+    AND (f.n IS NOT NULL OR c.n IS NOT NULL)
+) ranked
+WHERE ranked.position <= $4::integer
+`
+
+type RankTrendingRecipesParams struct {
+	WindowName    string  `json:"windowName"`
+	Gravity       float64 `json:"gravity"`
+	WindowSeconds float64 `json:"windowSeconds"`
+	MaxPerTeaType int32   `json:"maxPerTeaType"`
+}
+
+// Scores public recipes by favorites and comments made within the window,
+// decayed by recipe age with the given gravity, keeping the top recipes of
+// each tea type.
+func (q *Queries) RankTrendingRecipes(ctx context.Context, arg RankTrendingRecipesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rankTrendingRecipes,
+		arg.WindowName,
+		arg.Gravity,
+		arg.WindowSeconds,
+		arg.MaxPerTeaType,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rateRecipe = `-- name: RateRecipe :one
+INSERT INTO ratings (user_id, recipe_id, stars, review)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, recipe_id) DO UPDATE SET
+  stars = EXCLUDED.stars,
+  review = EXCLUDED.review,
+  updated_at = NOW()
+RETURNING user_id, recipe_id, stars, review, created_at, updated_at
+`
+
+type RateRecipeParams struct {
+	UserID   int32       `json:"userId"`
+	RecipeID int32       `json:"recipeId"`
+	Stars    int32       `json:"stars"`
+	Review   pgtype.Text `json:"review"`
+}
+
+// Creates or replaces the user's rating of the recipe.
+func (q *Queries) RateRecipe(ctx context.Context, arg RateRecipeParams) (Rating, error) {
+	row := q.db.QueryRow(ctx, rateRecipe,
+		arg.UserID,
+		arg.RecipeID,
+		arg.Stars,
+		arg.Review,
+	)
+	var i Rating
+	err := row.Scan(
+		&i.UserID,
+		&i.RecipeID,
+		&i.Stars,
+		&i.Review,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const reactToComment = `-- name: ReactToComment :exec
+INSERT INTO comment_reactions (comment_id, user_id, reaction)
+VALUES ($1, $2, $3)
+ON CONFLICT (comment_id, user_id) DO UPDATE SET
+  reaction = EXCLUDED.reaction,
+  created_at = NOW()
+`
+
+type ReactToCommentParams struct {
+	CommentID int32  `json:"commentId"`
+	UserID    int32  `json:"userId"`
+	Reaction  string `json:"reaction"`
+}
+
+// Sets the user's reaction to the comment, replacing any previous one.
+func (q *Queries) ReactToComment(ctx context.Context, arg ReactToCommentParams) error {
+	_, err := q.db.Exec(ctx, reactToComment, arg.CommentID, arg.UserID, arg.Reaction)
+	return err
+}
+
+const reconcileCommentReactionCounts = `-- name: ReconcileCommentReactionCounts :execrows
+UPDATE recipe_comments rc SET
+  reactions_count = (SELECT count(*) FROM comment_reactions cr WHERE cr.comment_id = rc.id)
+WHERE rc.id = ANY($1::integer[])
+`
+
+// Recounts comments locked by LockDriftedCommentReactionCounts.
+func (q *Queries) ReconcileCommentReactionCounts(ctx context.Context, ids []int32) (int64, error) {
+	result, err := q.db.Exec(ctx, reconcileCommentReactionCounts, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const reconcileRecipeCounters = `-- name: ReconcileRecipeCounters :execrows
+UPDATE recipes r SET
+  comments_count = (SELECT count(*) FROM recipe_comments rc WHERE rc.recipe_id = r.id AND rc.deleted_at IS NULL),
+  favorites_count = (SELECT count(*) FROM favorites f WHERE f.recipe_id = r.id),
+  ratings_count = (SELECT count(*) FROM ratings ra WHERE ra.recipe_id = r.id),
+  ratings_sum = (SELECT COALESCE(sum(stars), 0) FROM ratings ra WHERE ra.recipe_id = r.id)
+WHERE r.id = ANY($1::integer[])
+`
+
+// Recounts recipes locked by LockDriftedRecipeCounters. Being a later
+// statement its snapshot sees everything committed before the lock, and
+// triggers of transactions still in flight wait for it.
+func (q *Queries) ReconcileRecipeCounters(ctx context.Context, ids []int32) (int64, error) {
+	result, err := q.db.Exec(ctx, reconcileRecipeCounters, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const renumberRecipeSteps = `-- name: RenumberRecipeSteps :exec
+UPDATE recipe_steps s
+SET step_number = o.position::integer
+FROM unnest($2::integer[]) WITH ORDINALITY AS o(id, position)
+WHERE s.id = o.id AND s.recipe_id = $1
+`
+
+type RenumberRecipeStepsParams struct {
+	RecipeID pgtype.Int4 `json:"recipeId"`
+	StepIds  []int32     `json:"stepIds"`
+}
+
+// Numbers the steps of a recipe by their position in step_ids.
+func (q *Queries) RenumberRecipeSteps(ctx context.Context, arg RenumberRecipeStepsParams) error {
+	_, err := q.db.Exec(ctx, renumberRecipeSteps, arg.RecipeID, arg.StepIds)
+	return err
+}
+
+const saveIdempotencyResponse = `-- name: SaveIdempotencyResponse :exec
+UPDATE idempotency_keys SET
+  status_code = $3,
+  content_type = $4,
+  response_body = $5
+WHERE user_id = $1 AND idempotency_key = $2
+`
+
+type SaveIdempotencyResponseParams struct {
+	UserID         int32       `json:"userId"`
+	IdempotencyKey string      `json:"idempotencyKey"`
+	StatusCode     pgtype.Int4 `json:"statusCode"`
+	ContentType    pgtype.Text `json:"contentType"`
+	ResponseBody   []byte      `json:"responseBody"`
+}
+
+func (q *Queries) SaveIdempotencyResponse(ctx context.Context, arg SaveIdempotencyResponseParams) error {
+	_, err := q.db.Exec(ctx, saveIdempotencyResponse,
+		arg.UserID,
+		arg.IdempotencyKey,
+		arg.StatusCode,
+		arg.ContentType,
+		arg.ResponseBody,
+	)
+	return err
+}
+
+const searchRecipes = `-- name: SearchRecipes :many
+WITH q AS (
+  SELECT websearch_to_tsquery('english', $4::text) AS query
+)
+SELECT
+  r.id, r.user_id, r.title, r.type, r.asset_id, r.created_at,
+  ts_rank_cd('{0.1, 0.2, 0.4, 1.0}', s.document, q.query)::real AS rank,
+  ts_headline('english', r.title || '. ' || r.description, q.query,
+    'MaxFragments=2, MinWords=5, MaxWords=20, StartSel=' || chr(2) || ', StopSel=' || chr(3))::text AS snippet
+FROM recipe_search s
+JOIN recipes r ON r.id = s.recipe_id
+CROSS JOIN q
+WHERE s.document @@ q.query
+  AND (r.is_public OR r.user_id = $1::integer)
+ORDER BY rank DESC, r.id DESC
+LIMIT $3 OFFSET $2
+`
+
+type SearchRecipesParams struct {
+	UserID     int32  `json:"userId"`
+	PageOffset int32  `json:"pageOffset"`
+	PageLimit  int32  `json:"pageLimit"`
+	Query      string `json:"query"`
+}
+
+type SearchRecipesRow struct {
+	ID        int32            `json:"id"`
+	UserID    pgtype.Int4      `json:"userId"`
+	Title     string           `json:"title"`
+	Type      int32            `json:"type"`
+	AssetID   string           `json:"assetId"`
+	CreatedAt pgtype.Timestamp `json:"createdAt"`
+	Rank      float32          `json:"rank"`
+	Snippet   string           `json:"snippet"`
+}
+
+// Ranks matches for a websearch style query among the recipes the user can
+// see. Highlights are wrapped in \x02 and \x03 so the caller can escape the
+// snippet before marking them up.
+func (q *Queries) SearchRecipes(ctx context.Context, arg SearchRecipesParams) ([]SearchRecipesRow, error) {
+	rows, err := q.db.Query(ctx, searchRecipes,
+		arg.UserID,
+		arg.PageOffset,
+		arg.PageLimit,
+		arg.Query,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchRecipesRow
+	for rows.Next() {
+		var i SearchRecipesRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.UserID,
 			&i.Title,
-			&i.Description,
 			&i.Type,
 			&i.AssetID,
-			&i.PrepTimeMinutes,
-			&i.Servings,
-			&i.IsPublic,
 			&i.CreatedAt,
-			&i.UpdatedAt,
+			&i.Rank,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -621,6 +2235,51 @@ func (q *Queries) ListUserRecipes(ctx context.Context, userID pgtype.Int4) ([]Re
 	return items, nil
 }
 
+const shiftRecipeSteps = `-- name: ShiftRecipeSteps :exec
+UPDATE recipe_steps
+SET step_number = step_number + $1::integer
+WHERE recipe_id = $2 AND step_number >= $3::integer
+`
+
+type ShiftRecipeStepsParams struct {
+	Delta          int32       `json:"delta"`
+	RecipeID       pgtype.Int4 `json:"recipeId"`
+	FromStepNumber int32       `json:"fromStepNumber"`
+}
+
+// Moves every step from step_number on by delta, opening or closing a gap.
+func (q *Queries) ShiftRecipeSteps(ctx context.Context, arg ShiftRecipeStepsParams) error {
+	_, err := q.db.Exec(ctx, shiftRecipeSteps, arg.Delta, arg.RecipeID, arg.FromStepNumber)
+	return err
+}
+
+const tombstoneComment = `-- name: TombstoneComment :exec
+UPDATE recipe_comments
+SET comment = '', deleted_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TombstoneComment(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, tombstoneComment, id)
+	return err
+}
+
+const touchRecipe = `-- name: TouchRecipe :one
+UPDATE recipes SET
+  updated_at = NOW(),
+  version = version + 1
+WHERE id = $1
+RETURNING version
+`
+
+// Bumps the version after changes to a recipe's child rows.
+func (q *Queries) TouchRecipe(ctx context.Context, id int32) (int32, error) {
+	row := q.db.QueryRow(ctx, touchRecipe, id)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
 const unfavoriteRecipe = `-- name: UnfavoriteRecipe :exec
 DELETE FROM favorites
 WHERE user_id = $1 AND recipe_id = $2
@@ -636,10 +2295,25 @@ func (q *Queries) UnfavoriteRecipe(ctx context.Context, arg UnfavoriteRecipePara
 	return err
 }
 
-const updateComment = `-- name: UpdateComment :exec
+const unfollowUser = `-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2
+`
+
+type UnfollowUserParams struct {
+	FollowerID int32 `json:"followerId"`
+	FolloweeID int32 `json:"followeeId"`
+}
+
+func (q *Queries) UnfollowUser(ctx context.Context, arg UnfollowUserParams) error {
+	_, err := q.db.Exec(ctx, unfollowUser, arg.FollowerID, arg.FolloweeID)
+	return err
+}
+
+const updateComment = `-- name: UpdateComment :execrows
 UPDATE recipe_comments
 SET comment = $2
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 type UpdateCommentParams struct {
@@ -647,12 +2321,15 @@ type UpdateCommentParams struct {
 	Comment string `json:"comment"`
 }
 
-func (q *Queries) UpdateComment(ctx context.Context, arg UpdateCommentParams) error {
-	_, err := q.db.Exec(ctx, updateComment, arg.ID, arg.Comment)
-	return err
+func (q *Queries) UpdateComment(ctx context.Context, arg UpdateCommentParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateComment, arg.ID, arg.Comment)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-const updateRecipe = `-- name: UpdateRecipe :exec
+const updateRecipe = `-- name: UpdateRecipe :one
 UPDATE recipes SET
   title = $2,
   description = $3,
@@ -661,8 +2338,10 @@ UPDATE recipes SET
   prep_time_minutes = $6,
   servings = $7,
   is_public = $8,
-  updated_at = NOW()
+  updated_at = NOW(),
+  version = version + 1
 WHERE id = $1
+RETURNING version
 `
 
 type UpdateRecipeParams struct {
@@ -676,8 +2355,8 @@ type UpdateRecipeParams struct {
 	IsPublic        pgtype.Bool `json:"isPublic"`
 }
 
-func (q *Queries) UpdateRecipe(ctx context.Context, arg UpdateRecipeParams) error {
-	_, err := q.db.Exec(ctx, updateRecipe,
+func (q *Queries) UpdateRecipe(ctx context.Context, arg UpdateRecipeParams) (int32, error) {
+	row := q.db.QueryRow(ctx, updateRecipe,
 		arg.ID,
 		arg.Title,
 		arg.Description,
@@ -687,7 +2366,9 @@ func (q *Queries) UpdateRecipe(ctx context.Context, arg UpdateRecipeParams) erro
 		arg.Servings,
 		arg.IsPublic,
 	)
-	return err
+	var version int32
+	err := row.Scan(&version)
+	return version, err
 }
 
 const updateRecipeStep = `-- name: UpdateRecipeStep :exec
@@ -715,3 +2396,52 @@ func (q *Queries) UpdateRecipeStep(ctx context.Context, arg UpdateRecipeStepPara
 	)
 	return err
 }
+
+const updateRecipeStepContent = `-- name: UpdateRecipeStepContent :one
+UPDATE recipe_steps
+SET
+  description = $3,
+  asset_id = $4
+WHERE id = $1 AND recipe_id = $2
+RETURNING id, recipe_id, step_number, description, asset_id
+`
+
+type UpdateRecipeStepContentParams struct {
+	ID          int32       `json:"id"`
+	RecipeID    pgtype.Int4 `json:"recipeId"`
+	Description string      `json:"description"`
+	AssetID     pgtype.Text `json:"assetId"`
+}
+
+func (q *Queries) UpdateRecipeStepContent(ctx context.Context, arg UpdateRecipeStepContentParams) (RecipeStep, error) {
+	row := q.db.QueryRow(ctx, updateRecipeStepContent,
+		arg.ID,
+		arg.RecipeID,
+		arg.Description,
+		arg.AssetID,
+	)
+	var i RecipeStep
+	err := row.Scan(
+		&i.ID,
+		&i.RecipeID,
+		&i.StepNumber,
+		&i.Description,
+		&i.AssetID,
+	)
+	return i, err
+}
+
+const upsertIngredient = `-- name: UpsertIngredient :one
+INSERT INTO ingredients (name)
+VALUES ($1)
+ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+RETURNING id, name
+`
+
+// Returns the dictionary entry for name, adding it on first use.
+func (q *Queries) UpsertIngredient(ctx context.Context, name string) (Ingredient, error) {
+	row := q.db.QueryRow(ctx, upsertIngredient, name)
+	var i Ingredient
+	err := row.Scan(&i.ID, &i.Name)
+	return i, err
+}
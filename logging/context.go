@@ -8,6 +8,15 @@ const (
 	Method    ContextKey = "method"
 	Path      ContextKey = "path"
 	SourceIP  ContextKey = "source_ip"
+	UserAgent ContextKey = "user_agent"
 	Email     ContextKey = "email"
 	UserId    ContextKey = "userId"
+	TraceId   ContextKey = "trace_id"
+	SpanId    ContextKey = "span_id"
+	Response  ContextKey = "response"
+	Route     ContextKey = "route"
+	Status    ContextKey = "status"
+	Bytes     ContextKey = "bytes"
+
+	DebugSampled ContextKey = "debug_sampled"
 )
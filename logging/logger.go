@@ -3,35 +3,95 @@ package logger
 import (
 	"context"
 	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
+// CustomHandler adds the request group to every record logged with a request
+// context. When Level is set, records below it are only emitted for requests
+// that were sampled for debug logging; the wrapped Handler must then be
+// enabled for those lower levels.
 type CustomHandler struct {
 	slog.Handler
+	Level slog.Leveler
+}
+
+// ResponseInfo is filled in once the handler chain has run, so the last
+// lines logged for a request carry its outcome.
+type ResponseInfo struct {
+	Route  string
+	Status int
+	Bytes  int
+}
+
+func (l CustomHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if l.Level != nil && level < l.Level.Level() && !isSampled(ctx) {
+		return false
+	}
+	return l.Handler.Enabled(ctx, level)
 }
 
 func (l CustomHandler) Handle(ctx context.Context, r slog.Record) error {
-	if ctx.Value(RequestId) == nil {
+	requestId, ok := ctx.Value(RequestId).(string)
+	if !ok {
 		return l.Handler.Handle(ctx, r)
 	}
 
-	requestId := ctx.Value(RequestId).(string)
-	sourceIp := ctx.Value(SourceIP).(string)
-	path := ctx.Value(Path).(string)
-	method := ctx.Value(Method).(string)
-	email := ctx.Value(Email)
-	userId := ctx.Value(UserId)
-
-	requestGroup := slog.Group(
-		string(Request),
+	attrs := []any{
 		slog.String(string(RequestId), requestId),
-		slog.String(string(SourceIP), sourceIp),
-		slog.String(string(Method), method),
-		slog.String(string(Path), path),
-		slog.Any(string(Email), email),
-		slog.Any(string(UserId), userId),
-	)
+		slog.String(string(SourceIP), stringValue(ctx, SourceIP)),
+		slog.String(string(Method), stringValue(ctx, Method)),
+		slog.String(string(Path), stringValue(ctx, Path)),
+		slog.String(string(UserAgent), stringValue(ctx, UserAgent)),
+		slog.Any(string(Email), ctx.Value(Email)),
+		slog.Any(string(UserId), ctx.Value(UserId)),
+	}
+
+	if info, ok := ctx.Value(Response).(*ResponseInfo); ok && info.Status != 0 {
+		attrs = append(attrs,
+			slog.String(string(Route), info.Route),
+			slog.Int(string(Status), info.Status),
+			slog.Int(string(Bytes), info.Bytes),
+		)
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = append(attrs,
+			slog.String(string(TraceId), sc.TraceID().String()),
+			slog.String(string(SpanId), sc.SpanID().String()),
+		)
+	}
+
+	requestGroup := slog.Group(string(Request), attrs...)
 
 	r.AddAttrs(requestGroup)
 
 	return l.Handler.Handle(ctx, r)
 }
+
+func (l CustomHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return CustomHandler{Handler: l.Handler.WithAttrs(attrs), Level: l.Level}
+}
+
+func (l CustomHandler) WithGroup(name string) slog.Handler {
+	return CustomHandler{Handler: l.Handler.WithGroup(name), Level: l.Level}
+}
+
+// SetResponse records the outcome of the request for subsequent log lines.
+func SetResponse(ctx context.Context, route string, status, bytes int) {
+	if info, ok := ctx.Value(Response).(*ResponseInfo); ok {
+		info.Route = route
+		info.Status = status
+		info.Bytes = bytes
+	}
+}
+
+func stringValue(ctx context.Context, key ContextKey) string {
+	v, _ := ctx.Value(key).(string)
+	return v
+}
+
+func isSampled(ctx context.Context) bool {
+	sampled, _ := ctx.Value(DebugSampled).(bool)
+	return sampled
+}
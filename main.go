@@ -5,75 +5,181 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"ChaiwalaBackend/clients/jwt"
 	"ChaiwalaBackend/clients/s3"
+	"ChaiwalaBackend/config"
 	"ChaiwalaBackend/db"
 	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/metrics"
 	"ChaiwalaBackend/middlewares"
+	"ChaiwalaBackend/ratelimit"
+	common "ChaiwalaBackend/routes"
 	"ChaiwalaBackend/routes/assets"
 	"ChaiwalaBackend/routes/comments"
 	"ChaiwalaBackend/routes/favorites"
+	"ChaiwalaBackend/routes/feed"
+	"ChaiwalaBackend/routes/health"
 	"ChaiwalaBackend/routes/recipes"
 	"ChaiwalaBackend/routes/users"
+	"ChaiwalaBackend/scheduler"
+	"ChaiwalaBackend/tracing"
+	"ChaiwalaBackend/trending"
 	"ChaiwalaBackend/utils"
 
 	"github.com/dusted-go/logging/prettylog"
 	"github.com/gofiber/fiber/v3"
-	"github.com/jackc/pgx/v5"
+	"github.com/gofiber/fiber/v3/middleware/cors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-type AppConfig struct {
-	APP_ENV               string
-	PORT                  string
-	AWS_REGION            string
-	AWS_ACCESS_KEY_ID     string
-	AWS_SECRET_ACCESS_KEY string
-	S3_BUCKET_NAME        string
-	LOG_LEVEL             slog.Level
-	POSTGRES_URL          string
-}
-
-func newAppConfig() *AppConfig {
-	logLevel := utils.Must(strconv.Atoi((os.Getenv("LOG_LEVEL"))))
-
-	return &AppConfig{
-		APP_ENV:               os.Getenv("APP_ENV"),
-		PORT:                  ":" + os.Getenv("PORT"),
-		AWS_REGION:            os.Getenv("AWS_REGION"),
-		AWS_ACCESS_KEY_ID:     os.Getenv("AWS_ACCESS_KEY_ID"),
-		AWS_SECRET_ACCESS_KEY: os.Getenv("AWS_SECRET_ACCESS_KEY"),
-		S3_BUCKET_NAME:        os.Getenv("S3_BUCKET_NAME"),
-		POSTGRES_URL:          os.Getenv("POSTGRES_URL"),
-		LOG_LEVEL:             slog.Level(logLevel),
-	}
-}
-
 func main() {
-	ac := newAppConfig()
+	ac, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	logger := slog.New(logger.CustomHandler{Handler: getLoggerHandler(ac)})
+	logger := slog.New(logger.CustomHandler{Handler: getLoggerHandler(ac), Level: ac.LOG_LEVEL})
 	slog.SetDefault(logger)
+	slog.Info("loaded config", slog.Any("config", ac))
+
+	// cancelled on SIGINT or SIGTERM, stopping background jobs and the servers
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing := utils.Must(tracing.Init(
+		context.Background(),
+		ac.OTEL_EXPORTER,
+		ac.OTEL_EXPORTER_OTLP_ENDPOINT,
+		ac.OTEL_SERVICE_NAME,
+		ac.OTEL_SAMPLE_RATIO,
+	))
+
+	jwtClient := jwt.New(ac.SIGNING_KEY, ac.JWT_ISSUER)
+
+	poolConfig := utils.Must(pgxpool.ParseConfig(ac.POSTGRES_URL))
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
+	pool := utils.Must(pgxpool.NewWithConfig(context.Background(), poolConfig))
+	defer pool.Close()
+
+	prometheus.MustRegister(metrics.NewPoolCollector(pool))
+
+	dbConn := db.New(pool)
+
+	scheduler.Every(ctx, "delete expired idempotency keys", ac.IDEMPOTENCY_CLEANUP_INTERVAL, func(ctx context.Context) error {
+		_, err := dbConn.DeleteExpiredIdempotencyKeys(ctx)
+		return err
+	})
+	scheduler.Every(ctx, "reconcile counters", ac.COUNTER_RECONCILE_INTERVAL, func(ctx context.Context) error {
+		fixed, err := reconcile(ctx, pool, (*db.Queries).LockDriftedRecipeCounters, (*db.Queries).ReconcileRecipeCounters)
+		if fixed > 0 {
+			slog.WarnContext(ctx, "fixed drifted recipe counters", slog.Int64("recipes", fixed))
+		}
+		if err != nil {
+			return err
+		}
+
+		fixed, err = reconcile(ctx, pool, (*db.Queries).LockDriftedCommentReactionCounts, (*db.Queries).ReconcileCommentReactionCounts)
+		if fixed > 0 {
+			slog.WarnContext(ctx, "fixed drifted comment reaction counters", slog.Int64("comments", fixed))
+		}
+		return err
+	})
+	scheduler.EveryFromNow(ctx, "refresh trending recipes", ac.TRENDING_REFRESH_INTERVAL, func(ctx context.Context) error {
+		return trending.Refresh(ctx, pool, ac.TRENDING_WINDOWS, ac.TRENDING_GRAVITY)
+	})
 
-	app := fiber.New()
+	s3Client := s3.New(
+		context.Background(),
+		ac.AWS_REGION,
+		ac.S3_BUCKET_NAME,
+		ac.AWS_ACCESS_KEY_ID,
+		ac.AWS_SECRET_ACCESS_KEY,
+	)
 
-	app.Use(middlewares.SetContext())
-	app.Use(middlewares.Timing())
-	app.Use(middlewares.JWT())
+	app := fiber.New(fiber.Config{
+		BodyLimit: max(ac.BODY_LIMIT_JSON, ac.BODY_LIMIT_FILES),
+	})
 
-	conn := utils.Must(pgx.Connect(context.Background(), ac.POSTGRES_URL))
-	//nolint:errcheck
-	defer conn.Close(context.Background())
+	app.Use(middlewares.SetContext(ac.LOG_DEBUG_SAMPLE_RATE))
+	app.Use(middlewares.Metrics())
+	app.Use(middlewares.AccessLog(middlewares.AccessLogConfig{
+		Format: ac.ACCESS_LOG_FORMAT,
+		Output: middlewares.NewAccessLogWriter(
+			ac.ACCESS_LOG_OUTPUT,
+			ac.ACCESS_LOG_MAX_SIZE_MB,
+			ac.ACCESS_LOG_MAX_BACKUPS,
+			ac.ACCESS_LOG_MAX_AGE_DAYS,
+		),
+		RedactHeaders: ac.ACCESS_LOG_REDACT_HEADERS,
+		RedactQuery:   ac.ACCESS_LOG_REDACT_QUERY,
+		SlowThreshold: ac.ACCESS_LOG_SLOW_THRESHOLD,
+	}))
+	// without configured origins fiber's cors allows every origin, so only
+	// enable it when the environment lists its frontends
+	if len(ac.CORS_ALLOWED_ORIGINS) > 0 {
+		app.Use(cors.New(cors.Config{
+			AllowOrigins:     ac.CORS_ALLOWED_ORIGINS,
+			AllowCredentials: ac.CORS_ALLOW_CREDENTIALS,
+			AllowHeaders: []string{
+				fiber.HeaderAuthorization,
+				fiber.HeaderContentType,
+				middlewares.REQUEST_ID_HEADER,
+				middlewares.IDEMPOTENCY_KEY_HEADER,
+				fiber.HeaderIfMatch,
+				fiber.HeaderIfNoneMatch,
+			},
+			ExposeHeaders: []string{
+				middlewares.REQUEST_ID_HEADER,
+				middlewares.IDEMPOTENT_REPLAYED_HEADER,
+				fiber.HeaderETag,
+				fiber.HeaderLink,
+				fiber.HeaderRetryAfter,
+				"RateLimit-Limit",
+				"RateLimit-Remaining",
+				"RateLimit-Reset",
+			},
+			MaxAge: int(ac.CORS_MAX_AGE.Seconds()),
+		}))
+	}
+	app.Use(middlewares.SecurityHeaders(middlewares.SecurityHeadersConfig{
+		HSTSMaxAge:                ac.HSTS_MAX_AGE,
+		ContentSecurityPolicy:     middlewares.API_CSP,
+		CrossOriginResourcePolicy: "same-site",
+	}))
+	app.Use(middlewares.BodyLimit(ac.BODY_LIMIT_JSON, map[string]int{"/files": ac.BODY_LIMIT_FILES}))
 
-	dbConn := db.New(conn)
+	// no user is known before JWT so this limiter is keyed by ip and also
+	// covers requests that fail authentication
+	limiterStore := ratelimit.NewMemoryStore(ctx, time.Minute)
+	app.Use(middlewares.RateLimit(limiterStore, "ip", ac.RATE_LIMIT_IP))
+	app.Use(middlewares.JWT(jwtClient))
+	app.Use(middlewares.RateLimit(limiterStore, "default", ac.RATE_LIMIT_DEFAULT))
+	app.Use(middlewares.Idempotency(dbConn, ac.IDEMPOTENCY_TTL))
 
-	s3Client := s3.New(context.Background(), ac.AWS_REGION, ac.S3_BUCKET_NAME)
+	// prefixed middleware goes after the global chain so its headers and
+	// limits override the global ones
+	app.Use("/files", middlewares.SecurityHeaders(middlewares.SecurityHeadersConfig{
+		HSTSMaxAge:                ac.HSTS_MAX_AGE,
+		ContentSecurityPolicy:     middlewares.FILE_CSP,
+		CrossOriginResourcePolicy: "cross-origin",
+	}))
+	app.Use("/auth", middlewares.RateLimit(limiterStore, "auth", ac.RATE_LIMIT_AUTH))
+	app.Use("/files", middlewares.RateLimit(limiterStore, "files", ac.RATE_LIMIT_FILES))
+	app.Use("/comments", middlewares.RateLimit(limiterStore, "comments", ac.RATE_LIMIT_COMMENTS))
 
-	users.BuildAuthRouter(app, dbConn)
+	health.BuildRouter(app, pool, s3Client, ac.READINESS_TIMEOUT, ac.READINESS_CACHE_TTL)
+	users.BuildAuthRouter(app, dbConn, jwtClient)
 	users.BuildRouter(app, dbConn)
-	recipes.BuildRouter(app, conn, dbConn)
-	comments.BuildRouter(app, dbConn)
+	recipes.BuildRouter(app, pool, dbConn, ac.TRENDING_WINDOWS)
+	comments.BuildRouter(app, pool, dbConn)
 	favorites.BuildRouter(app, dbConn)
+	feed.BuildRouter(app, dbConn, ac.TRENDING_WINDOWS)
 	assets.BuildRouter(app, s3Client)
 
 	app.Get("", func(c fiber.Ctx) error {
@@ -86,21 +192,85 @@ func main() {
 		fmt.Printf("%s %s\n", route.Method, route.Path)
 	}
 
+	// metrics expose pool stats, business counters and routes, so they are
+	// served on their own port instead of next to the public api
+	metricsApp := fiber.New()
+	metricsApp.Get("/metrics", metrics.Handler())
+	go func() {
+		utils.LogThrowable(
+			context.Background(),
+			metricsApp.Listen(":"+ac.METRICS_PORT, fiber.ListenConfig{DisableStartupMessage: true}))
+	}()
+
+	// Listen returns as soon as shutdown starts, wait for in flight requests
+	// to finish before flushing their spans
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		slog.Info("shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ac.SHUTDOWN_TIMEOUT)
+		defer cancel()
+		utils.LogThrowable(shutdownCtx, app.ShutdownWithContext(shutdownCtx))
+		utils.LogThrowable(shutdownCtx, metricsApp.ShutdownWithContext(shutdownCtx))
+	}()
+
 	utils.LogThrowable(
 		context.Background(),
-		app.Listen(ac.PORT, fiber.ListenConfig{DisableStartupMessage: true}))
+		app.Listen(":"+ac.PORT, fiber.ListenConfig{DisableStartupMessage: true}))
+	stop()
+	<-shutdownDone
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), ac.SHUTDOWN_TIMEOUT)
+	defer cancel()
+	utils.LogThrowable(flushCtx, shutdownTracing(flushCtx))
 }
 
-func getLoggerHandler(ac *AppConfig) slog.Handler {
+// reconcile recounts drifted counters in two statements of one transaction:
+// lock takes the rows to fix, recount then runs with a snapshot taken after
+// the locks so it cannot overwrite a concurrent trigger with a stale count.
+func reconcile(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	lock func(*db.Queries, context.Context) ([]int32, error),
+	recount func(*db.Queries, context.Context, []int32) (int64, error),
+) (int64, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer common.Rollback(ctx, tx)
+
+	q := db.New(tx)
+	ids, err := lock(q, ctx)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	fixed, err := recount(q, ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	return fixed, tx.Commit(ctx)
+}
+
+func getLoggerHandler(ac *config.AppConfig) slog.Handler {
+	// sampled requests log at DEBUG, CustomHandler filters the rest down to LOG_LEVEL
+	level := ac.LOG_LEVEL
+	if ac.LOG_DEBUG_SAMPLE_RATE > 0 {
+		level = min(level, slog.LevelDebug)
+	}
+
 	if ac.APP_ENV == "PRODUCTION" {
 		return slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level:     ac.LOG_LEVEL,
+			Level:     level,
 			AddSource: true,
 		})
 	}
 
 	return prettylog.NewHandler(&slog.HandlerOptions{
-		Level:       ac.LOG_LEVEL,
+		Level:       level,
 		AddSource:   true,
 		ReplaceAttr: nil,
 	})
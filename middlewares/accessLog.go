@@ -0,0 +1,204 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "ChaiwalaBackend/logging"
+
+	"github.com/gofiber/fiber/v3"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	ACCESS_LOG_COMMON   = "common"
+	ACCESS_LOG_COMBINED = "combined"
+	ACCESS_LOG_JSON     = "json"
+
+	clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+	redactedValue = "[REDACTED]"
+	// redactedQueryValue needs no escaping, keeping the logged URI readable
+	redactedQueryValue = "REDACTED"
+)
+
+type AccessLogConfig struct {
+	// Format is one of ACCESS_LOG_COMMON, ACCESS_LOG_COMBINED or ACCESS_LOG_JSON.
+	Format string
+	Output io.Writer
+	// RedactHeaders are request headers whose values are never written.
+	RedactHeaders []string
+	// RedactQuery are query parameters whose values are never written.
+	RedactQuery []string
+	// SlowThreshold flags requests taking at least this long, 0 disables it.
+	SlowThreshold time.Duration
+}
+
+type accessLogEntry struct {
+	Time       time.Time         `json:"time"`
+	RequestId  string            `json:"requestId"`
+	RemoteIP   string            `json:"remoteIp"`
+	User       string            `json:"user,omitempty"`
+	Method     string            `json:"method"`
+	URI        string            `json:"uri"`
+	Protocol   string            `json:"protocol"`
+	Route      string            `json:"route"`
+	Status     int               `json:"status"`
+	Bytes      int               `json:"bytes"`
+	DurationMs float64           `json:"durationMs"`
+	Referer    string            `json:"referer,omitempty"`
+	UserAgent  string            `json:"userAgent,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Slow       bool              `json:"slow,omitempty"`
+}
+
+// NewAccessLogWriter returns stdout, stderr or a file at output that is
+// rotated once it reaches maxSizeMB.
+func NewAccessLogWriter(output string, maxSizeMB, maxBackups, maxAgeDays int) io.Writer {
+	switch output {
+	case "", "stdout":
+		return os.Stdout
+	case "stderr":
+		return os.Stderr
+	}
+
+	return &lumberjack.Logger{
+		Filename:   output,
+		MaxSize:    maxSizeMB,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAgeDays,
+		Compress:   true,
+	}
+}
+
+// AccessLog writes one line per request to cfg.Output, separate from the
+// application logs.
+func AccessLog(cfg AccessLogConfig) fiber.Handler {
+	redactHeaders := make(map[string]bool, len(cfg.RedactHeaders))
+	for _, h := range cfg.RedactHeaders {
+		redactHeaders[strings.ToLower(h)] = true
+	}
+	templates := &routeTemplates{}
+
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+
+		duration := time.Since(start)
+		e := accessLogEntry{
+			Time:       start,
+			RequestId:  c.GetRespHeader(REQUEST_ID_HEADER),
+			RemoteIP:   c.IP(),
+			Method:     c.Method(),
+			URI:        redactQuery(c.OriginalURL(), cfg.RedactQuery),
+			Protocol:   c.Protocol(),
+			Route:      templates.of(c),
+			Status:     statusCode(c, err),
+			Bytes:      responseBytes(c),
+			DurationMs: float64(duration.Microseconds()) / 1000,
+			Referer:    c.Get(fiber.HeaderReferer),
+			UserAgent:  c.Get(fiber.HeaderUserAgent),
+			Slow:       cfg.SlowThreshold > 0 && duration >= cfg.SlowThreshold,
+		}
+		if userId, ok := c.Locals(logger.UserId).(int32); ok {
+			e.User = strconv.Itoa(int(userId))
+		}
+
+		var line bytes.Buffer
+		switch cfg.Format {
+		case ACCESS_LOG_JSON:
+			e.Headers = requestHeaders(c, redactHeaders)
+			enc := json.NewEncoder(&line)
+			enc.SetEscapeHTML(false)
+			_ = enc.Encode(e)
+		case ACCESS_LOG_COMMON:
+			line.WriteString(commonLogLine(e))
+		default:
+			line.WriteString(commonLogLine(e))
+			fmt.Fprintf(&line, ` "%s" "%s"`, orDash(e.Referer), orDash(e.UserAgent))
+		}
+
+		if cfg.Format != ACCESS_LOG_JSON {
+			if e.Slow {
+				fmt.Fprintf(&line, " [SLOW %s]", duration)
+			}
+			line.WriteByte('\n')
+		}
+
+		_, _ = cfg.Output.Write(line.Bytes())
+
+		return err
+	}
+}
+
+func commonLogLine(e accessLogEntry) string {
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.Itoa(e.Bytes)
+	}
+
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		e.RemoteIP,
+		orDash(e.User),
+		e.Time.Format(clfTimeFormat),
+		e.Method,
+		e.URI,
+		e.Protocol,
+		e.Status,
+		size,
+	)
+}
+
+// redactQuery replaces the values of sensitive query parameters in uri.
+func redactQuery(uri string, params []string) string {
+	if len(params) == 0 || !strings.Contains(uri, "?") {
+		return uri
+	}
+
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return uri
+	}
+
+	q := u.Query()
+	changed := false
+	for _, p := range params {
+		if q.Has(p) {
+			q.Set(p, redactedQueryValue)
+			changed = true
+		}
+	}
+	if !changed {
+		return uri
+	}
+
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+func requestHeaders(c fiber.Ctx, redact map[string]bool) map[string]string {
+	headers := c.GetReqHeaders()
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if redact[strings.ToLower(k)] {
+			out[k] = redactedValue
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
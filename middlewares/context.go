@@ -3,27 +3,108 @@ package middlewares
 import (
 	"context"
 	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strings"
 
 	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/tracing"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func SetContext() fiber.Handler {
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// validRequestId bounds what we accept from upstream so ids are safe to log
+// and echo back.
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// SetContext populates the request context used by logging and tracing.
+// debugSampleRate is the fraction of requests whose debug logs are emitted
+// regardless of the configured log level.
+func SetContext(debugSampleRate float64) fiber.Handler {
+	templates := &routeTemplates{}
 	return func(c fiber.Ctx) error {
 		slog.Debug("adding additional request context")
-		requestId := uuid.NewString()
-		ctx := c.Context()
+		// fiber strings point into the pooled request buffers, spans are
+		// exported and log records written after the request is recycled
+		requestId := strings.Clone(c.Get(REQUEST_ID_HEADER))
+		if !validRequestId.MatchString(requestId) {
+			requestId = uuid.NewString()
+		}
+		method := strings.Clone(c.Method())
+		path := strings.Clone(c.Path())
+		ip := strings.Clone(c.IP())
+
+		ctx := otel.GetTextMapPropagator().Extract(c.Context(), headerCarrier{c})
+
+		ctx, span := tracing.Tracer().Start(ctx, method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.URLPath(path),
+				semconv.ClientAddress(ip),
+			),
+		)
+		defer span.End()
 
 		ctx = context.WithValue(ctx, logger.RequestId, requestId)
-		ctx = context.WithValue(ctx, logger.Method, c.Method())
-		ctx = context.WithValue(ctx, logger.Path, c.Path())
-		ctx = context.WithValue(ctx, logger.SourceIP, c.IP())
+		ctx = context.WithValue(ctx, logger.Method, method)
+		ctx = context.WithValue(ctx, logger.Path, path)
+		ctx = context.WithValue(ctx, logger.SourceIP, ip)
+		ctx = context.WithValue(ctx, logger.UserAgent, strings.Clone(c.Get(fiber.HeaderUserAgent)))
+		ctx = context.WithValue(ctx, logger.Response, &logger.ResponseInfo{})
+		ctx = context.WithValue(ctx, logger.DebugSampled, debugSampleRate > 0 && rand.Float64() < debugSampleRate)
 		// set user related context settings in jwt middleware
 		c.SetContext(ctx)
-		c.Response().Header.Set("X-Request-ID", requestId)
+		c.Response().Header.Set(REQUEST_ID_HEADER, requestId)
+
+		err := c.Next()
+
+		route := templates.of(c)
+		status := statusCode(c, err)
+		logger.SetResponse(ctx, route, status, responseBytes(c))
+		span.SetName(method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, fiber.ErrInternalServerError.Message)
+		}
+
+		return err
+	}
+}
+
+// headerCarrier adapts fiber request/response headers to propagation.TextMapCarrier.
+type headerCarrier struct {
+	c fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.c.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0)
+	for k := range h.c.GetReqHeaders() {
+		keys = append(keys, k)
+	}
+	return keys
+}
 
-		return c.Next()
+// responseBytes is the size of the response body, using the declared
+// Content-Length for streamed bodies.
+func responseBytes(c fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		return max(c.Response().Header.ContentLength(), 0)
 	}
+	return len(c.Response().Body())
 }
@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"ChaiwalaBackend/db"
+	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/routes"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	IDEMPOTENCY_KEY_HEADER     = "Idempotency-Key"
+	IDEMPOTENT_REPLAYED_HEADER = "Idempotent-Replayed"
+	maxIdempotencyKeyLength    = 255
+	idempotencyInProgressRetry = "1"
+)
+
+// Idempotency makes authenticated POST requests carrying an Idempotency-Key
+// safe to retry. The first response for a key is stored for ttl and replayed
+// for retries with the same body; reusing a key with a different body is a
+// 409. Failed (5xx) requests release the key so they can be retried.
+func Idempotency(dbConn *db.Queries, ttl time.Duration) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		key := c.Get(IDEMPOTENCY_KEY_HEADER)
+		if c.Method() != fiber.MethodPost || key == "" {
+			return c.Next()
+		}
+
+		userId, ok := c.Locals(logger.UserId).(int32)
+		if !ok {
+			return c.Next()
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			return routes.SendErrorResponse(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		}
+
+		hash := requestHash(c)
+
+		_, err := dbConn.ClaimIdempotencyKey(c.Context(), db.ClaimIdempotencyKeyParams{
+			UserID:         userId,
+			IdempotencyKey: key,
+			RequestHash:    hash,
+			TtlSeconds:     ttl.Seconds(),
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return replay(c, dbConn, userId, key, hash)
+		}
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return routes.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
+		}
+
+		err = c.Next()
+
+		status := statusCode(c, err)
+		if err != nil || status >= http.StatusInternalServerError {
+			delErr := dbConn.DeleteIdempotencyKey(c.Context(), db.DeleteIdempotencyKeyParams{
+				UserID:         userId,
+				IdempotencyKey: key,
+			})
+			if delErr != nil {
+				slog.ErrorContext(c.Context(), delErr.Error())
+			}
+			return err
+		}
+
+		saveErr := dbConn.SaveIdempotencyResponse(c.Context(), db.SaveIdempotencyResponseParams{
+			UserID:         userId,
+			IdempotencyKey: key,
+			StatusCode:     pgtype.Int4{Int32: int32(status), Valid: true},
+			ContentType:    pgtype.Text{String: string(c.Response().Header.ContentType()), Valid: true},
+			ResponseBody:   append([]byte(nil), c.Response().Body()...),
+		})
+		if saveErr != nil {
+			slog.ErrorContext(c.Context(), saveErr.Error())
+		}
+
+		return nil
+	}
+}
+
+func replay(c fiber.Ctx, dbConn *db.Queries, userId int32, key, hash string) error {
+	stored, err := dbConn.GetIdempotencyKey(c.Context(), db.GetIdempotencyKeyParams{
+		UserID:         userId,
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		slog.ErrorContext(c.Context(), err.Error())
+		return routes.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
+	}
+
+	if stored.RequestHash != hash {
+		return routes.SendErrorResponse(c, http.StatusConflict, "Idempotency-Key was already used for a different request")
+	}
+
+	if !stored.StatusCode.Valid {
+		c.Set(fiber.HeaderRetryAfter, idempotencyInProgressRetry)
+		return routes.SendErrorResponse(c, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+	}
+
+	slog.InfoContext(c.Context(), "replaying idempotent response")
+	c.Set(IDEMPOTENT_REPLAYED_HEADER, "true")
+	if stored.ContentType.Valid {
+		c.Set(fiber.HeaderContentType, stored.ContentType.String)
+	}
+	return c.Status(int(stored.StatusCode.Int32)).Send(stored.ResponseBody)
+}
+
+// requestHash identifies the request a key was first used with.
+func requestHash(c fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.OriginalURL() + "\n"))
+	h.Write(c.BodyRaw())
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -13,17 +13,24 @@ import (
 	"github.com/gofiber/fiber/v3"
 )
 
-func JWT() fiber.Handler {
-	return func(c fiber.Ctx) error {
-		path := c.Path()
+// PUBLIC_PATHS are served without a token.
+var PUBLIC_PATHS = map[string]bool{
+	"/auth/login":    true,
+	"/auth/register": true,
+	"/healthz":       true,
+	"/readyz":        true,
+	"/version":       true,
+}
 
-		if path == "/auth/login" || path == "/auth/register" {
-			slog.InfoContext(c.Context(), "skipping on auth routes")
+func JWT(jwtClient jwtD.JWTClient) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if PUBLIC_PATHS[c.Path()] {
+			slog.DebugContext(c.Context(), "skipping jwt on public route")
 			return c.Next()
 		}
 
 		tokenStr := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
-		claims, err := jwtD.ValidateToken(c, tokenStr)
+		claims, err := jwtClient.ValidateToken(c, tokenStr)
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return routes.SendErrorResponse(c, http.StatusUnauthorized, err.Error())
@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ChaiwalaBackend/metrics"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func Metrics() fiber.Handler {
+	templates := &routeTemplates{}
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		metrics.HTTPInFlight.Inc()
+		defer metrics.HTTPInFlight.Dec()
+
+		err := c.Next()
+
+		// label values are kept by the registry, so the method can't point
+		// into the pooled request
+		labels := []string{strings.Clone(c.Method()), templates.of(c), strconv.Itoa(statusCode(c, err))}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// UNMATCHED_ROUTE labels requests that did not reach an endpoint.
+const UNMATCHED_ROUTE = "unmatched"
+
+// routeTemplates labels requests with the registered path of the endpoint they
+// matched (e.g. /recipes/:recipeId) so metrics and logs don't explode on raw
+// paths. Requests that only reached middleware, because no endpoint matched or
+// a middleware such as JWT rejected them first, are labeled UNMATCHED_ROUTE.
+// Every middleware keeps its own set of endpoints, built from the app serving
+// the first request.
+type routeTemplates struct {
+	once      sync.Once
+	endpoints map[string]bool
+}
+
+func (t *routeTemplates) of(c fiber.Ctx) string {
+	r := c.Route()
+	if r == nil {
+		return UNMATCHED_ROUTE
+	}
+
+	t.once.Do(func() {
+		t.endpoints = map[string]bool{}
+		for _, route := range c.App().GetRoutes(true) {
+			t.endpoints[route.Method+" "+route.Path] = true
+		}
+	})
+	if !t.endpoints[r.Method+" "+r.Path] {
+		return UNMATCHED_ROUTE
+	}
+	// a Use prefix can share its path with an endpoint, e.g. /files, but
+	// only the endpoint matches when the request path is the whole template
+	if len(r.Params) == 0 && !samePath(c.App().Config(), c.Path(), r.Path) {
+		return UNMATCHED_ROUTE
+	}
+	return r.Path
+}
+
+// samePath compares a request path to a template without params the way the
+// router does.
+func samePath(cfg fiber.Config, path, template string) bool {
+	if !cfg.StrictRouting {
+		path = strings.TrimSuffix(path, "/")
+		template = strings.TrimSuffix(template, "/")
+	}
+	if !cfg.CaseSensitive {
+		return strings.EqualFold(path, template)
+	}
+	return path == template
+}
+
+// statusCode is the status that will be sent once the error handler has run.
+func statusCode(c fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// labelApp builds an app shaped like main.go, with global and prefixed
+// middleware in front of the endpoints, and records the label of the last
+// request.
+func labelApp(label *string) *fiber.App {
+	app := fiber.New()
+	templates := &routeTemplates{}
+	app.Use(func(c fiber.Ctx) error {
+		err := c.Next()
+		*label = templates.of(c)
+		return err
+	})
+	app.Use(func(c fiber.Ctx) error {
+		if c.Get("X-Reject") != "" {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		return c.Next()
+	})
+	app.Use("/files", func(c fiber.Ctx) error { return c.Next() })
+
+	ok := func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("", ok)
+	app.Post("/files", ok)
+	app.Get("/files/:fileId", ok)
+	app.Get("/recipes/:recipeId", ok)
+	return app
+}
+
+func TestRouteTemplates(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		reject bool
+		want   string
+	}{
+		{fiber.MethodGet, "/", false, "/"},
+		{fiber.MethodGet, "/recipes/1", false, "/recipes/:recipeId"},
+		{fiber.MethodGet, "/recipes/2", false, "/recipes/:recipeId"},
+		{fiber.MethodPost, "/files", false, "/files"},
+		{fiber.MethodPost, "/FILES/", false, "/files"},
+		{fiber.MethodGet, "/files/abc", false, "/files/:fileId"},
+
+		// unknown paths collapse into one label
+		{fiber.MethodGet, "/nope", false, UNMATCHED_ROUTE},
+		{fiber.MethodGet, "/recipes", false, UNMATCHED_ROUTE},
+		{fiber.MethodDelete, "/recipes/1", false, UNMATCHED_ROUTE},
+		{fiber.MethodGet, "/files", false, UNMATCHED_ROUTE},
+		{fiber.MethodPost, "/files/a/b", false, UNMATCHED_ROUTE},
+
+		// rejected by middleware before reaching the endpoint
+		{fiber.MethodGet, "/recipes/1", true, UNMATCHED_ROUTE},
+		{fiber.MethodPost, "/files", true, UNMATCHED_ROUTE},
+	}
+
+	var label string
+	app := labelApp(&label)
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.reject {
+				req.Header.Set("X-Reject", "1")
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+			if label != tt.want {
+				t.Errorf("label = %q, want %q", label, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteTemplatesPerApp(t *testing.T) {
+	var first, second string
+	a := labelApp(&first)
+	b := labelApp(&second)
+	b.Get("/feed", func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	// the first app serving a request must not decide the second's endpoints
+	for _, app := range []*fiber.App{a, b} {
+		if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/feed", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first != UNMATCHED_ROUTE {
+		t.Errorf("first app label = %q, want %q", first, UNMATCHED_ROUTE)
+	}
+	if second != "/feed" {
+		t.Errorf("second app label = %q, want %q", second, "/feed")
+	}
+}
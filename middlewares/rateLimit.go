@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/ratelimit"
+	"ChaiwalaBackend/routes"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// RateLimit applies limit to every request reaching it, with a bucket per
+// authenticated user, or per source ip for anonymous requests. group
+// namespaces the buckets so each route group is limited independently.
+// Store errors fail open.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if !limit.Enabled() {
+			return c.Next()
+		}
+
+		key := group + ":ip:" + c.IP()
+		if userId, ok := c.Locals(logger.UserId).(int32); ok {
+			key = group + ":user:" + strconv.Itoa(int(userId))
+		}
+
+		res, err := store.Take(c.Context(), key, limit)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error(), slog.String("group", group))
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+
+		if !res.Allowed {
+			slog.InfoContext(c.Context(), "rate limited", slog.String("group", group))
+			c.Set(fiber.HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+			return routes.SendErrorResponse(c, http.StatusTooManyRequests, "Too many requests, please slow down.")
+		}
+
+		return c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
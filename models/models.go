@@ -0,0 +1,218 @@
+// Package models holds the API representations of the db types, with the
+// pgtype wrappers flattened into plain JSON values.
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"ChaiwalaBackend/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type User struct {
+	ID        int32     `json:"id"`
+	Email     string    `json:"email"`
+	Bio       string    `json:"bio"`
+	AvatarURL string    `json:"avatarUrl"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Recipe struct {
+	ID              int32     `json:"id"`
+	UserID          int32     `json:"userId"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	TeaType         int32     `json:"teaType"`
+	AssetID         string    `json:"assetId"`
+	PrepTimeMinutes *int32    `json:"prepTimeMinutes"`
+	Servings        *int32    `json:"servings"`
+	IsPublic        bool      `json:"isPublic"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+	Version         int32     `json:"version"`
+	CommentsCount   int32     `json:"commentsCount"`
+	FavoritesCount  int32     `json:"favoritesCount"`
+	RatingsCount    int32     `json:"ratingsCount"`
+	// AverageRating is nil until the recipe has been rated.
+	AverageRating *float64 `json:"averageRating"`
+}
+
+type Step struct {
+	ID          int32  `json:"id"`
+	StepNumber  int32  `json:"stepNumber"`
+	Description string `json:"description"`
+	AssetID     string `json:"assetId,omitempty"`
+}
+
+// Ingredient is a recipe ingredient, Name is matched against the shared
+// ingredient dictionary.
+type Ingredient struct {
+	Name     string   `json:"name"`
+	Quantity *float64 `json:"quantity,omitempty"`
+	Unit     string   `json:"unit,omitempty"`
+	Note     string   `json:"note,omitempty"`
+}
+
+// Rating is a user's star rating of a recipe.
+type Rating struct {
+	RecipeID  int32     `json:"recipeId"`
+	UserID    int32     `json:"userId"`
+	Stars     int32     `json:"stars"`
+	Review    string    `json:"review,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Comment is a comment in a thread. Deleted comments that have replies are
+// kept as tombstones, without their text or author.
+type Comment struct {
+	ID         int32  `json:"id"`
+	RecipeID   int32  `json:"recipeId"`
+	ParentID   *int32 `json:"parentId"`
+	Depth      int32  `json:"depth"`
+	Comment    string `json:"comment"`
+	Email      string `json:"email,omitempty"`
+	AvatarURL  string `json:"avatarUrl,omitempty"`
+	ReplyCount int32  `json:"replyCount"`
+	// Reactions counts the reactions of each kind, kinds nobody used are left
+	// out.
+	Reactions map[string]int32 `json:"reactions"`
+	// MyReaction is the requesting user's reaction, empty if they have not
+	// reacted.
+	MyReaction string    `json:"myReaction"`
+	Deleted    bool      `json:"deleted"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// RecipeSummary is a recipe in a list, as seen by the requesting user.
+type RecipeSummary struct {
+	Recipe
+	FavoritedByMe bool `json:"favoritedByMe"`
+}
+
+// RecipeDetail is a recipe with everything the recipe page shows.
+type RecipeDetail struct {
+	Recipe
+	Author      User         `json:"author"`
+	Steps       []Step       `json:"steps"`
+	Ingredients []Ingredient `json:"ingredients"`
+	// ScaledServings is the number of servings Ingredients are given for.
+	ScaledServings int32 `json:"scaledServings,omitempty"`
+	FavoritedByMe  bool  `json:"favoritedByMe"`
+	// RatingDistribution counts the ratings of each star, from 1 to 5.
+	RatingDistribution []int32 `json:"ratingDistribution"`
+	// MyRating is the requesting user's stars, nil if they have not rated it.
+	MyRating *int32 `json:"myRating"`
+}
+
+func FromUser(u db.User) User {
+	return User{
+		ID:        u.ID,
+		Email:     u.Email,
+		Bio:       u.Bio,
+		AvatarURL: u.AvatarUrl,
+		CreatedAt: u.CreatedAt.Time,
+	}
+}
+
+func FromRecipe(r db.Recipe) Recipe {
+	return Recipe{
+		ID:              r.ID,
+		UserID:          r.UserID.Int32,
+		Title:           r.Title,
+		Description:     r.Description,
+		TeaType:         r.Type,
+		AssetID:         r.AssetID,
+		PrepTimeMinutes: int4Ptr(r.PrepTimeMinutes),
+		Servings:        int4Ptr(r.Servings),
+		IsPublic:        r.IsPublic.Bool,
+		CreatedAt:       r.CreatedAt.Time,
+		UpdatedAt:       r.UpdatedAt.Time,
+		Version:         r.Version,
+		CommentsCount:   r.CommentsCount,
+		FavoritesCount:  r.FavoritesCount,
+		RatingsCount:    r.RatingsCount,
+		AverageRating:   averageRating(r.RatingsSum, r.RatingsCount),
+	}
+}
+
+func FromRecipes(recipes []db.Recipe) []Recipe {
+	out := make([]Recipe, len(recipes))
+	for i, r := range recipes {
+		out[i] = FromRecipe(r)
+	}
+	return out
+}
+
+func FromRating(r db.Rating) Rating {
+	return Rating{
+		RecipeID:  r.RecipeID,
+		UserID:    r.UserID,
+		Stars:     r.Stars,
+		Review:    r.Review.String,
+		CreatedAt: r.CreatedAt.Time,
+		UpdatedAt: r.UpdatedAt.Time,
+	}
+}
+
+func FromComment(rc db.RecipeComment, author db.User, replyCount int32) Comment {
+	c := Comment{
+		ID:         rc.ID,
+		RecipeID:   rc.RecipeID.Int32,
+		ParentID:   int4Ptr(rc.ParentID),
+		Depth:      rc.Depth,
+		Comment:    rc.Comment,
+		ReplyCount: replyCount,
+		Deleted:    rc.DeletedAt.Valid,
+		CreatedAt:  rc.CreatedAt.Time,
+	}
+	if !c.Deleted {
+		c.Email = author.Email
+		c.AvatarURL = author.AvatarUrl
+	}
+	return c
+}
+
+// WithReactions sets the reaction counts, aggregated by the comment queries as
+// a JSON object, and the requesting user's reaction.
+func (c Comment) WithReactions(counts []byte, mine string) (Comment, error) {
+	if err := json.Unmarshal(counts, &c.Reactions); err != nil {
+		return c, err
+	}
+	c.MyReaction = mine
+	return c, nil
+}
+
+func FromStep(s db.RecipeStep) Step {
+	return Step{
+		ID:          s.ID,
+		StepNumber:  s.StepNumber,
+		Description: s.Description,
+		AssetID:     s.AssetID.String,
+	}
+}
+
+func FromSteps(steps []db.RecipeStep) []Step {
+	out := make([]Step, len(steps))
+	for i, s := range steps {
+		out[i] = FromStep(s)
+	}
+	return out
+}
+
+func averageRating(sum, count int32) *float64 {
+	if count <= 0 {
+		return nil
+	}
+	avg := float64(sum) / float64(count)
+	return &avg
+}
+
+func int4Ptr(v pgtype.Int4) *int32 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int32
+}
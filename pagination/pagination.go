@@ -0,0 +1,168 @@
+// Package pagination implements opaque cursor pagination for list endpoints.
+// Lists ordered by (created_at, id) page by keyset, orderings without a
+// stable key, like relevance, keep an offset inside the cursor instead.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	CURSOR_PARAM = "cursor"
+	LIMIT_PARAM  = "limit"
+
+	DEFAULT_LIMIT = 10
+	MAX_LIMIT     = 500
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// Cursor points just after the last item of a page.
+type Cursor struct {
+	CreatedAt time.Time `json:"t,omitzero"`
+	ID        int32     `json:"i,omitempty"`
+	Offset    int32     `json:"o,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func Decode(s string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.Offset < 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Request is the page asked for by the client.
+type Request struct {
+	// Cursor is nil for the first page.
+	Cursor *Cursor
+	Limit  int32
+}
+
+// Parse reads the cursor and limit query parameters. Its errors are meant to
+// be shown to the client.
+func Parse(c fiber.Ctx) (Request, error) {
+	r := Request{Limit: DEFAULT_LIMIT}
+
+	if v := c.Query(LIMIT_PARAM); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MAX_LIMIT {
+			return r, fmt.Errorf("Limit must be between 1 and %d", MAX_LIMIT)
+		}
+		r.Limit = int32(limit)
+	}
+
+	if v := c.Query(CURSOR_PARAM); v != "" {
+		cursor, err := Decode(v)
+		if err != nil {
+			return r, err
+		}
+		r.Cursor = &cursor
+	}
+
+	return r, nil
+}
+
+// Fetch is the number of rows to query, one more than the limit to find out
+// whether there is a next page.
+func (r Request) Fetch() int32 {
+	return r.Limit + 1
+}
+
+// After returns the keyset to continue from, both values are null on the
+// first page.
+func (r Request) After() (pgtype.Timestamp, pgtype.Int4) {
+	if r.Cursor == nil || r.Cursor.CreatedAt.IsZero() {
+		return pgtype.Timestamp{}, pgtype.Int4{}
+	}
+	return pgtype.Timestamp{Time: r.Cursor.CreatedAt, Valid: true}, pgtype.Int4{Int32: r.Cursor.ID, Valid: true}
+}
+
+// Offset is the number of rows to skip for offset paged lists.
+func (r Request) Offset() int32 {
+	if r.Cursor == nil {
+		return 0
+	}
+	return r.Cursor.Offset
+}
+
+// Page is the envelope every list endpoint responds with.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// NewPage builds a keyset page from up to r.Fetch() rows, key returns the
+// (created_at, id) of an item.
+func NewPage[T any](r Request, items []T, key func(T) (pgtype.Timestamp, int32)) Page[T] {
+	p := trim(r, items)
+	if p.HasMore {
+		createdAt, id := key(p.Items[len(p.Items)-1])
+		p.NextCursor = Cursor{CreatedAt: createdAt.Time, ID: id}.Encode()
+	}
+	return p
+}
+
+// NewOffsetPage builds a page for lists that cannot be keyset paginated.
+func NewOffsetPage[T any](r Request, items []T) Page[T] {
+	p := trim(r, items)
+	if p.HasMore {
+		p.NextCursor = Cursor{Offset: r.Offset() + r.Limit}.Encode()
+	}
+	return p
+}
+
+// WithItems returns p with its items replaced, keeping the cursor. It is used
+// to turn the rows a page was built from into response types.
+func WithItems[T, U any](p Page[T], items []U) Page[U] {
+	if items == nil {
+		items = []U{}
+	}
+	return Page[U]{Items: items, NextCursor: p.NextCursor, HasMore: p.HasMore}
+}
+
+func trim[T any](r Request, items []T) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	p := Page[T]{Items: items}
+	if len(items) > int(r.Limit) {
+		p.Items = items[:r.Limit]
+		p.HasMore = true
+	}
+	return p
+}
+
+// SetLinkHeader advertises the next page as an RFC 8288 Link header.
+func SetLinkHeader(c fiber.Ctx, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+
+	u, err := url.ParseRequestURI(c.OriginalURL())
+	if err != nil {
+		return
+	}
+	q := u.Query()
+	q.Set(CURSOR_PARAM, nextCursor)
+	u.RawQuery = q.Encode()
+
+	c.Append(fiber.HeaderLink, fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI()))
+}
@@ -19,21 +19,145 @@ SELECT * FROM recipes
 WHERE is_public = true
 ORDER BY created_at DESC;
 
--- name: ListPublicRecipesPaginated :many
-SELECT * FROM recipes
-WHERE is_public = true
-ORDER BY created_at DESC
-LIMIT $1 OFFSET $2;
+-- name: FilterPublicRecipes :many
+-- Every filter is optional, an empty tea_types matches all tea types. sort is
+-- one of newest, favorites, comments, quickest or rating. The cursor only
+-- applies to newest, the other orderings page by offset.
+--
+-- rating orders by the Bayesian average rating: every recipe starts with
+-- rating_prior_weight ratings of the site wide average, so a handful of 5
+-- star ratings do not outrank a recipe rated well by many.
+SELECT r.* FROM recipes r
+WHERE r.is_public = true
+  AND (sqlc.narg(max_prep_time)::integer IS NULL OR r.prep_time_minutes <= sqlc.narg(max_prep_time))
+  AND (sqlc.narg(min_servings)::integer IS NULL OR r.servings >= sqlc.narg(min_servings))
+  AND (sqlc.narg(max_servings)::integer IS NULL OR r.servings <= sqlc.narg(max_servings))
+  AND (sqlc.narg(author_id)::integer IS NULL OR r.user_id = sqlc.narg(author_id))
+  AND (sqlc.narg(created_after)::timestamp IS NULL OR r.created_at > sqlc.narg(created_after))
+  AND (sqlc.narg(has_image)::boolean IS NULL OR (r.asset_id <> '') = sqlc.narg(has_image))
+  AND (cardinality(sqlc.arg(tea_types)::integer[]) = 0 OR r.type = ANY(sqlc.arg(tea_types)::integer[]))
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (r.created_at, r.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY
+  CASE WHEN sqlc.arg(sort)::text = 'favorites' THEN r.favorites_count END DESC,
+  CASE WHEN sqlc.arg(sort)::text = 'comments' THEN r.comments_count END DESC,
+  CASE WHEN sqlc.arg(sort)::text = 'quickest'
+    THEN r.prep_time_minutes END ASC NULLS LAST,
+  CASE WHEN sqlc.arg(sort)::text = 'rating' THEN
+    (r.ratings_sum + sqlc.arg(rating_prior_weight)::float8 * (
+      SELECT COALESCE(sum(ratings_sum)::float8 / NULLIF(sum(ratings_count), 0), 0)
+      FROM recipes
+      WHERE is_public = true
+    )) / (r.ratings_count + sqlc.arg(rating_prior_weight)::float8)
+  END DESC,
+  r.created_at DESC, r.id DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: CountPublicRecipesByTeaType :many
+-- Facet counts for FilterPublicRecipes, ignoring its tea type filter so every
+-- tea type chip shows how many recipes selecting it would add.
+SELECT r.type, count(*) AS count FROM recipes r
+WHERE r.is_public = true
+  AND (sqlc.narg(max_prep_time)::integer IS NULL OR r.prep_time_minutes <= sqlc.narg(max_prep_time))
+  AND (sqlc.narg(min_servings)::integer IS NULL OR r.servings >= sqlc.narg(min_servings))
+  AND (sqlc.narg(max_servings)::integer IS NULL OR r.servings <= sqlc.narg(max_servings))
+  AND (sqlc.narg(author_id)::integer IS NULL OR r.user_id = sqlc.narg(author_id))
+  AND (sqlc.narg(created_after)::timestamp IS NULL OR r.created_at > sqlc.narg(created_after))
+  AND (sqlc.narg(has_image)::boolean IS NULL OR (r.asset_id <> '') = sqlc.narg(has_image))
+GROUP BY r.type
+ORDER BY r.type;
+
+-- name: SearchRecipes :many
+-- Ranks matches for a websearch style query among the recipes the user can
+-- see. Highlights are wrapped in \x02 and \x03 so the caller can escape the
+-- snippet before marking them up.
+WITH q AS (
+  SELECT websearch_to_tsquery('english', sqlc.arg(query)::text) AS query
+)
+SELECT
+  r.id, r.user_id, r.title, r.type, r.asset_id, r.created_at,
+  ts_rank_cd('{0.1, 0.2, 0.4, 1.0}', s.document, q.query)::real AS rank,
+  ts_headline('english', r.title || '. ' || r.description, q.query,
+    'MaxFragments=2, MinWords=5, MaxWords=20, StartSel=' || chr(2) || ', StopSel=' || chr(3))::text AS snippet
+FROM recipe_search s
+JOIN recipes r ON r.id = s.recipe_id
+CROSS JOIN q
+WHERE s.document @@ q.query
+  AND (r.is_public OR r.user_id = sqlc.arg(user_id)::integer)
+ORDER BY rank DESC, r.id DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
 
 
 -- name: GetRecipe :one
 SELECT * FROM recipes
 WHERE id = $1;
 
+-- name: GetRecipeDetail :one
+-- Everything the recipe page shows in one round trip, nested rows are
+-- aggregated as JSON.
+SELECT
+  sqlc.embed(r),
+  json_build_object(
+    'id', u.id,
+    'email', u.email,
+    'bio', u.bio,
+    'avatarUrl', u.avatar_url,
+    'createdAt', u.created_at AT TIME ZONE 'UTC'
+  )::jsonb AS author,
+  COALESCE((
+    SELECT jsonb_agg(jsonb_build_object(
+      'id', s.id,
+      'stepNumber', s.step_number,
+      'description', s.description,
+      'assetId', s.asset_id
+    ) ORDER BY s.step_number)
+    FROM recipe_steps s
+    WHERE s.recipe_id = r.id
+  ), '[]')::jsonb AS steps,
+  COALESCE((
+    SELECT jsonb_agg(jsonb_build_object(
+      'name', i.name,
+      'quantity', ri.quantity,
+      'unit', ri.unit,
+      'note', ri.note
+    ) ORDER BY ri.position)
+    FROM recipe_ingredients ri
+    JOIN ingredients i ON ri.ingredient_id = i.id
+    WHERE ri.recipe_id = r.id
+  ), '[]')::jsonb AS ingredients,
+  EXISTS (
+    SELECT 1 FROM favorites f
+    WHERE f.recipe_id = r.id AND f.user_id = sqlc.arg(viewer_id)::integer
+  ) AS favorited_by_me,
+  ARRAY(
+    SELECT count(ra.user_id)
+    FROM generate_series(1, 5) AS s (stars)
+    LEFT JOIN ratings ra ON ra.recipe_id = r.id AND ra.stars = s.stars
+    GROUP BY s.stars
+    ORDER BY s.stars
+  )::integer[] AS rating_distribution,
+  COALESCE((
+    SELECT ra.stars FROM ratings ra
+    WHERE ra.recipe_id = r.id AND ra.user_id = sqlc.arg(viewer_id)::integer
+  ), 0)::integer AS my_rating
+FROM recipes r
+JOIN users u ON u.id = r.user_id
+WHERE r.id = sqlc.arg(id);
+
+-- name: GetRecipeForUpdate :one
+SELECT * FROM recipes
+WHERE id = $1
+FOR UPDATE;
+
 -- name: ListUserRecipes :many
+-- Private recipes are only listed to their author.
 SELECT * FROM recipes
-WHERE user_id = $1
-ORDER BY created_at DESC;
+WHERE user_id = sqlc.arg(user_id)
+  AND (is_public OR user_id = sqlc.arg(viewer_id)::integer)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_limit);
 
 -- name: CreateRecipe :one
 INSERT INTO recipes (
@@ -44,7 +168,7 @@ INSERT INTO recipes (
 )
 RETURNING *;
 
--- name: UpdateRecipe :exec
+-- name: UpdateRecipe :one
 UPDATE recipes SET
   title = $2,
   description = $3,
@@ -53,8 +177,36 @@ UPDATE recipes SET
   prep_time_minutes = $6,
   servings = $7,
   is_public = $8,
-  updated_at = NOW()
-WHERE id = $1;
+  updated_at = NOW(),
+  version = version + 1
+WHERE id = $1
+RETURNING version;
+
+-- name: PatchRecipe :one
+-- Only touches columns whose params are set. Nullable columns have an explicit
+-- set_ flag so a patch can clear them.
+UPDATE recipes SET
+  title = COALESCE(sqlc.narg(title)::varchar, title),
+  description = COALESCE(sqlc.narg(description)::text, description),
+  type = COALESCE(sqlc.narg(type)::integer, type),
+  asset_id = COALESCE(sqlc.narg(asset_id)::text, asset_id),
+  prep_time_minutes = CASE WHEN sqlc.arg(set_prep_time_minutes)::boolean
+    THEN sqlc.narg(prep_time_minutes)::integer ELSE prep_time_minutes END,
+  servings = CASE WHEN sqlc.arg(set_servings)::boolean
+    THEN sqlc.narg(servings)::integer ELSE servings END,
+  is_public = COALESCE(sqlc.narg(is_public)::boolean, is_public),
+  updated_at = NOW(),
+  version = version + 1
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: TouchRecipe :one
+-- Bumps the version after changes to a recipe's child rows.
+UPDATE recipes SET
+  updated_at = NOW(),
+  version = version + 1
+WHERE id = $1
+RETURNING version;
 
 -- name: DeleteRecipe :exec
 DELETE FROM recipes
@@ -89,6 +241,31 @@ WHERE id = $1;
 SELECT * FROM recipe_steps
 WHERE recipe_id = $1 AND step_number = $2;
 
+-- name: GetLastRecipeStepNumber :one
+SELECT COALESCE(MAX(step_number), 0)::integer FROM recipe_steps
+WHERE recipe_id = $1;
+
+-- name: UpdateRecipeStepContent :one
+UPDATE recipe_steps
+SET
+  description = $3,
+  asset_id = $4
+WHERE id = $1 AND recipe_id = $2
+RETURNING *;
+
+-- name: ShiftRecipeSteps :exec
+-- Moves every step from step_number on by delta, opening or closing a gap.
+UPDATE recipe_steps
+SET step_number = step_number + sqlc.arg(delta)::integer
+WHERE recipe_id = sqlc.arg(recipe_id) AND step_number >= sqlc.arg(from_step_number)::integer;
+
+-- name: RenumberRecipeSteps :exec
+-- Numbers the steps of a recipe by their position in step_ids.
+UPDATE recipe_steps s
+SET step_number = o.position::integer
+FROM unnest(sqlc.arg(step_ids)::integer[]) WITH ORDINALITY AS o(id, position)
+WHERE s.id = o.id AND s.recipe_id = sqlc.arg(recipe_id);
+
 -- name: GetRecipeStepsByRecipe :many
 SELECT * FROM recipe_steps
 WHERE recipe_id = $1
@@ -99,35 +276,177 @@ SELECT * FROM recipe_steps
 WHERE recipe_id = $1
 ORDER BY step_number;
 
+-- name: UpsertIngredient :one
+-- Returns the dictionary entry for name, adding it on first use.
+INSERT INTO ingredients (name)
+VALUES ($1)
+ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+RETURNING *;
+
+-- name: AddRecipeIngredient :one
+INSERT INTO recipe_ingredients (
+  recipe_id, ingredient_id, position, quantity, unit, note
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: DeleteRecipeIngredients :exec
+DELETE FROM recipe_ingredients
+WHERE recipe_id = $1;
+
+-- name: ListRecipeIngredients :many
+SELECT ri.id, ri.position, i.name, ri.quantity, ri.unit, ri.note
+FROM recipe_ingredients ri
+JOIN ingredients i ON ri.ingredient_id = i.id
+WHERE ri.recipe_id = $1
+ORDER BY ri.position;
+
 -- name: AddComment :one
 INSERT INTO recipe_comments (
-  recipe_id, user_id, comment
+  recipe_id, user_id, comment, parent_id, depth
 ) VALUES (
-  $1, $2, $3
+  $1, $2, $3, $4, $5
 )
 RETURNING *;
 
+-- name: GetComment :one
+SELECT * FROM recipe_comments
+WHERE id = $1;
+
+-- name: GetCommentForUpdate :one
+SELECT * FROM recipe_comments
+WHERE id = $1
+FOR UPDATE;
+
+-- name: HasCommentReplies :one
+SELECT EXISTS (
+  SELECT 1 FROM recipe_comments
+  WHERE parent_id = $1
+) AS has_replies;
+
 -- name: ListComments :many
-SELECT rc.comment, rc.created_at, u.email, u.avatar_url
+-- Top level comments of the recipe with their number of direct replies, their
+-- reaction counts and the viewer's reaction. sort is newest or top, the
+-- cursor only applies to newest, top pages by offset.
+SELECT
+  sqlc.embed(rc),
+  sqlc.embed(u),
+  (SELECT count(*) FROM recipe_comments r WHERE r.parent_id = rc.id)::integer AS reply_count,
+  COALESCE((
+    SELECT jsonb_object_agg(cr.reaction, cr.n)
+    FROM (
+      SELECT reaction, count(*) AS n FROM comment_reactions
+      WHERE comment_id = rc.id
+      GROUP BY reaction
+    ) cr
+  ), '{}')::jsonb AS reactions,
+  COALESCE((
+    SELECT reaction FROM comment_reactions
+    WHERE comment_id = rc.id AND user_id = sqlc.arg(viewer_id)::integer
+  ), '')::text AS my_reaction
+FROM recipe_comments rc
+JOIN users u ON rc.user_id = u.id
+WHERE rc.recipe_id = sqlc.arg(recipe_id)
+  AND rc.parent_id IS NULL
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (rc.created_at, rc.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY
+  CASE WHEN sqlc.arg(sort)::text = 'top' THEN rc.reactions_count END DESC,
+  rc.created_at DESC, rc.id DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: ListCommentReplies :many
+-- Direct replies to a comment, oldest first so threads read in order.
+SELECT
+  sqlc.embed(rc),
+  sqlc.embed(u),
+  (SELECT count(*) FROM recipe_comments r WHERE r.parent_id = rc.id)::integer AS reply_count,
+  COALESCE((
+    SELECT jsonb_object_agg(cr.reaction, cr.n)
+    FROM (
+      SELECT reaction, count(*) AS n FROM comment_reactions
+      WHERE comment_id = rc.id
+      GROUP BY reaction
+    ) cr
+  ), '{}')::jsonb AS reactions,
+  COALESCE((
+    SELECT reaction FROM comment_reactions
+    WHERE comment_id = rc.id AND user_id = sqlc.arg(viewer_id)::integer
+  ), '')::text AS my_reaction
 FROM recipe_comments rc
 JOIN users u ON rc.user_id = u.id
-WHERE rc.recipe_id = $1
-ORDER BY rc.created_at DESC;
+WHERE rc.parent_id = sqlc.arg(parent_id)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (rc.created_at, rc.id) > (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY rc.created_at, rc.id
+LIMIT sqlc.arg(page_limit);
 
 -- name: ListCommentsByUser :many
-SELECT * FROM recipe_comments
-WHERE user_id = $1
-ORDER BY created_at DESC;
+SELECT
+  sqlc.embed(rc),
+  sqlc.embed(u),
+  (SELECT count(*) FROM recipe_comments r WHERE r.parent_id = rc.id)::integer AS reply_count,
+  COALESCE((
+    SELECT jsonb_object_agg(cr.reaction, cr.n)
+    FROM (
+      SELECT reaction, count(*) AS n FROM comment_reactions
+      WHERE comment_id = rc.id
+      GROUP BY reaction
+    ) cr
+  ), '{}')::jsonb AS reactions,
+  COALESCE((
+    SELECT reaction FROM comment_reactions
+    WHERE comment_id = rc.id AND user_id = sqlc.arg(viewer_id)::integer
+  ), '')::text AS my_reaction
+FROM recipe_comments rc
+JOIN users u ON rc.user_id = u.id
+WHERE rc.user_id = sqlc.arg(user_id)
+  AND rc.deleted_at IS NULL
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (rc.created_at, rc.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY rc.created_at DESC, rc.id DESC
+LIMIT sqlc.arg(page_limit);
 
--- name: UpdateComment :exec
+-- name: UpdateComment :execrows
 UPDATE recipe_comments
 SET comment = $2
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: DeleteComment :exec
 DELETE FROM recipe_comments
 WHERE id = $1;
 
+-- name: TombstoneComment :exec
+UPDATE recipe_comments
+SET comment = '', deleted_at = NOW()
+WHERE id = $1;
+
+-- name: ReactToComment :exec
+-- Sets the user's reaction to the comment, replacing any previous one.
+INSERT INTO comment_reactions (comment_id, user_id, reaction)
+VALUES ($1, $2, $3)
+ON CONFLICT (comment_id, user_id) DO UPDATE SET
+  reaction = EXCLUDED.reaction,
+  created_at = NOW();
+
+-- name: DeleteCommentReaction :exec
+DELETE FROM comment_reactions
+WHERE comment_id = $1 AND user_id = $2;
+
+-- name: LockDriftedCommentReactionCounts :many
+-- Locks the comments whose reaction counters drifted, see
+-- LockDriftedRecipeCounters.
+SELECT rc.id FROM recipe_comments rc
+WHERE rc.reactions_count <> (SELECT count(*) FROM comment_reactions cr WHERE cr.comment_id = rc.id)
+FOR UPDATE;
+
+-- name: ReconcileCommentReactionCounts :execrows
+-- Recounts comments locked by LockDriftedCommentReactionCounts.
+UPDATE recipe_comments rc SET
+  reactions_count = (SELECT count(*) FROM comment_reactions cr WHERE cr.comment_id = rc.id)
+WHERE rc.id = ANY(sqlc.arg(ids)::integer[]);
+
 -- name: FavoriteRecipe :exec
 INSERT INTO favorites (user_id, recipe_id)
 VALUES ($1, $2)
@@ -138,14 +457,230 @@ DELETE FROM favorites
 WHERE user_id = $1 AND recipe_id = $2;
 
 -- name: ListUserFavorites :many
-SELECT r.*
+-- Private recipes are left out unless the viewer wrote them.
+SELECT sqlc.embed(r), f.created_at AS favorited_at
 FROM favorites f
 JOIN recipes r ON f.recipe_id = r.id
-WHERE f.user_id = $1
-ORDER BY f.created_at DESC;
+WHERE f.user_id = sqlc.arg(user_id)
+  AND (r.is_public OR r.user_id = sqlc.arg(viewer_id)::integer)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (f.created_at, r.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY f.created_at DESC, r.id DESC
+LIMIT sqlc.arg(page_limit);
 
 -- name: IsRecipeFavorited :one
 SELECT EXISTS (
   SELECT 1 FROM favorites
   WHERE user_id = $1 AND recipe_id = $2
 ) AS favorited;
+
+-- name: RateRecipe :one
+-- Creates or replaces the user's rating of the recipe.
+INSERT INTO ratings (user_id, recipe_id, stars, review)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, recipe_id) DO UPDATE SET
+  stars = EXCLUDED.stars,
+  review = EXCLUDED.review,
+  updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteRating :exec
+DELETE FROM ratings
+WHERE user_id = $1 AND recipe_id = $2;
+
+-- name: ListRecipeReviews :many
+-- Ratings of the recipe that come with a review, most recently updated first.
+SELECT sqlc.embed(ra), sqlc.embed(u)
+FROM ratings ra
+JOIN users u ON u.id = ra.user_id
+WHERE ra.recipe_id = sqlc.arg(recipe_id)
+  AND ra.review IS NOT NULL
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (ra.updated_at, ra.user_id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY ra.updated_at DESC, ra.user_id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT sqlc.embed(u), f.created_at AS followed_at
+FROM follows f
+JOIN users u ON u.id = f.follower_id
+WHERE f.followee_id = sqlc.arg(user_id)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (f.created_at, u.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY f.created_at DESC, u.id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: ListFollowing :many
+SELECT sqlc.embed(u), f.created_at AS followed_at
+FROM follows f
+JOIN users u ON u.id = f.followee_id
+WHERE f.follower_id = sqlc.arg(user_id)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (f.created_at, u.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+ORDER BY f.created_at DESC, u.id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: ListFeed :many
+-- Public recipes from followed users, newest first, mixed with the top
+-- trending recipes. Each branch applies the cursor and limit on its own so
+-- followed authors are read through idx_recipes_user_id_created_at, the
+-- branches don't overlap so UNION ALL skips the dedupe.
+WITH followed AS (
+  SELECT followee_id FROM follows WHERE follower_id = sqlc.arg(user_id)
+), popular AS (
+  SELECT recipe_id AS id FROM trending_recipes
+  WHERE window_name = sqlc.arg(trending_window)
+  ORDER BY score DESC, recipe_id DESC
+  LIMIT sqlc.arg(popular_limit)
+), feed AS (
+  SELECT fr.id, true AS from_following
+  FROM followed f
+  CROSS JOIN LATERAL (
+    SELECT r.id FROM recipes r
+    WHERE r.user_id = f.followee_id
+      AND r.is_public = true
+      AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+        OR (r.created_at, r.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+    ORDER BY r.created_at DESC, r.id DESC
+    LIMIT sqlc.arg(page_limit)
+  ) fr
+  UNION ALL
+  (
+    SELECT r.id, false AS from_following
+    FROM popular p
+    JOIN recipes r ON r.id = p.id
+    WHERE r.is_public = true
+      AND r.user_id NOT IN (SELECT followee_id FROM followed)
+      AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+        OR (r.created_at, r.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::integer))
+    ORDER BY r.created_at DESC, r.id DESC
+    LIMIT sqlc.arg(page_limit)
+  )
+)
+SELECT sqlc.embed(r), feed.from_following::boolean AS from_following
+FROM feed
+JOIN recipes r ON r.id = feed.id
+ORDER BY r.created_at DESC, r.id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: ClearTrendingRecipes :exec
+DELETE FROM trending_recipes
+WHERE window_name = $1;
+
+-- name: RankTrendingRecipes :execrows
+-- Scores public recipes by favorites and comments made within the window,
+-- decayed by recipe age with the given gravity, keeping the top recipes of
+-- each tea type.
+INSERT INTO trending_recipes (window_name, recipe_id, tea_type, score)
+SELECT sqlc.arg(window_name)::text, ranked.id, ranked.type, ranked.score
+FROM (
+  SELECT
+    r.id,
+    r.type,
+    (2 * COALESCE(f.n, 0) + COALESCE(c.n, 0))
+      / power(EXTRACT(EPOCH FROM NOW() - r.created_at) / 3600 + 2, sqlc.arg(gravity)::float8) AS score,
+    row_number() OVER (
+      PARTITION BY r.type
+      ORDER BY (2 * COALESCE(f.n, 0) + COALESCE(c.n, 0))
+        / power(EXTRACT(EPOCH FROM NOW() - r.created_at) / 3600 + 2, sqlc.arg(gravity)::float8) DESC
+    ) AS position
+  FROM recipes r
+  LEFT JOIN (
+    SELECT recipe_id, count(*) AS n FROM favorites
+    WHERE created_at > NOW() - make_interval(secs => sqlc.arg(window_seconds)::float8)
+    GROUP BY recipe_id
+  ) f ON f.recipe_id = r.id
+  LEFT JOIN (
+    SELECT recipe_id, count(*) AS n FROM recipe_comments
+    WHERE deleted_at IS NULL
+      AND created_at > NOW() - make_interval(secs => sqlc.arg(window_seconds)::float8)
+    GROUP BY recipe_id
+  ) c ON c.recipe_id = r.id
+  WHERE r.is_public = true
+    AND r.created_at IS NOT NULL
+    AND (f.n IS NOT NULL OR c.n IS NOT NULL)
+) ranked
+WHERE ranked.position <= sqlc.arg(max_per_tea_type)::integer;
+
+-- name: ListTrendingRecipes :many
+SELECT sqlc.embed(r), t.score
+FROM trending_recipes t
+JOIN recipes r ON r.id = t.recipe_id
+WHERE t.window_name = sqlc.arg(window_name)
+  AND r.is_public = true
+  AND (sqlc.narg(tea_type)::integer IS NULL OR t.tea_type = sqlc.narg(tea_type))
+ORDER BY t.score DESC, r.id DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: ListFavoritedRecipeIds :many
+-- Which of recipe_ids the user has favorited.
+SELECT recipe_id FROM favorites
+WHERE user_id = sqlc.arg(user_id) AND recipe_id = ANY(sqlc.arg(recipe_ids)::integer[]);
+
+-- name: LockDriftedRecipeCounters :many
+-- Locks the recipes whose counters drifted from the rows they count, so
+-- ReconcileRecipeCounters can recount them without racing the triggers.
+SELECT r.id FROM recipes r
+WHERE r.comments_count <> (SELECT count(*) FROM recipe_comments rc WHERE rc.recipe_id = r.id AND rc.deleted_at IS NULL)
+  OR r.favorites_count <> (SELECT count(*) FROM favorites f WHERE f.recipe_id = r.id)
+  OR r.ratings_count <> (SELECT count(*) FROM ratings ra WHERE ra.recipe_id = r.id)
+  OR r.ratings_sum <> (SELECT COALESCE(sum(stars), 0) FROM ratings ra WHERE ra.recipe_id = r.id)
+FOR UPDATE;
+
+-- name: ReconcileRecipeCounters :execrows
+-- Recounts recipes locked by LockDriftedRecipeCounters. Being a later
+-- statement its snapshot sees everything committed before the lock, and
+-- triggers of transactions still in flight wait for it.
+UPDATE recipes r SET
+  comments_count = (SELECT count(*) FROM recipe_comments rc WHERE rc.recipe_id = r.id AND rc.deleted_at IS NULL),
+  favorites_count = (SELECT count(*) FROM favorites f WHERE f.recipe_id = r.id),
+  ratings_count = (SELECT count(*) FROM ratings ra WHERE ra.recipe_id = r.id),
+  ratings_sum = (SELECT COALESCE(sum(stars), 0) FROM ratings ra WHERE ra.recipe_id = r.id)
+WHERE r.id = ANY(sqlc.arg(ids)::integer[]);
+
+-- name: ClaimIdempotencyKey :one
+-- Returns no rows when the key is already held by an unexpired request.
+-- Claims left in progress for over 5 minutes (e.g. after a crash) are reclaimed.
+INSERT INTO idempotency_keys (
+  user_id, idempotency_key, request_hash, expires_at
+) VALUES (
+  $1, $2, $3, NOW() + make_interval(secs => sqlc.arg(ttl_seconds)::float8)
+)
+ON CONFLICT (user_id, idempotency_key) DO UPDATE SET
+  request_hash = EXCLUDED.request_hash,
+  status_code = NULL,
+  content_type = NULL,
+  response_body = NULL,
+  created_at = NOW(),
+  expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at < NOW()
+  OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < NOW() - INTERVAL '5 minutes')
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE user_id = $1 AND idempotency_key = $2;
+
+-- name: SaveIdempotencyResponse :exec
+UPDATE idempotency_keys SET
+  status_code = $3,
+  content_type = $4,
+  response_body = $5
+WHERE user_id = $1 AND idempotency_key = $2;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE user_id = $1 AND idempotency_key = $2;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at < NOW();
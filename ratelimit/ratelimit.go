@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("limit must look like <requests>/<s|m|h>, e.g. 60/m")
+
+// Limit is a token bucket refilled at Requests per Per, holding at most
+// Requests tokens. The zero Limit disables rate limiting.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// rate is the number of tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+
+	unit := "s"
+	switch l.Per {
+	case time.Minute:
+		unit = "m"
+	case time.Hour:
+		unit = "h"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, unit)
+}
+
+// UnmarshalText parses limits like "60/m". "off" or "0" disables the limit.
+func (l *Limit) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "off" || s == "0" {
+		*l = Limit{}
+		return nil
+	}
+
+	n, unit, ok := strings.Cut(s, "/")
+	if !ok {
+		return ErrInvalidLimit
+	}
+
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests < 0 {
+		return ErrInvalidLimit
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return ErrInvalidLimit
+	}
+
+	*l = Limit{Requests: requests, Per: per}
+	return nil
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed,
+	// only set when the request was not allowed.
+	RetryAfter time.Duration
+}
+
+// Store takes a token for key. Implementations backed by a shared store
+// (e.g. redis) let limits hold across multiple instances.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
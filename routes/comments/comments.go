@@ -1,23 +1,39 @@
 package comments
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"ChaiwalaBackend/db"
+	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/metrics"
+	"ChaiwalaBackend/models"
+	"ChaiwalaBackend/pagination"
 	common "ChaiwalaBackend/routes"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func BuildRouter(app *fiber.App, dbConn *db.Queries) *fiber.Router {
+// MAX_COMMENT_DEPTH is the deepest a reply can be nested, top level comments
+// have depth 0.
+const MAX_COMMENT_DEPTH = 4
+
+func BuildRouter(app *fiber.App, pool *pgxpool.Pool, dbConn *db.Queries) *fiber.Router {
 	commentRouter := app.Group("/comments")
 
 	commentRouter.Post("", createComment(dbConn))
+	commentRouter.Get("/:commentId/replies", listReplies(dbConn))
 	commentRouter.Put("/:commentId", updateComment(dbConn))
-	commentRouter.Delete("/:commentId", deleteComment(dbConn))
+	commentRouter.Delete("/:commentId", deleteComment(pool))
+	commentRouter.Put("/:commentId/reaction", reactToComment(dbConn))
+	commentRouter.Delete("/:commentId/reaction", deleteReaction(dbConn))
 
 	return &commentRouter
 }
@@ -29,16 +45,100 @@ func createComment(dbConn *db.Queries) fiber.Handler {
 			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid Input")
 		}
 
-		createdComment, err := dbConn.AddComment(c.Context(), db.AddCommentParams{
+		author, err := dbConn.GetUser(c.Context(), c.Locals(logger.UserId).(int32))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusNotFound, "User not found")
+		}
+
+		params := db.AddCommentParams{
 			RecipeID: pgtype.Int4{Int32: comment.RecipeID, Valid: true},
-			UserID:   pgtype.Int4{Int32: comment.UserID, Valid: true},
+			UserID:   pgtype.Int4{Int32: author.ID, Valid: true},
 			Comment:  comment.Comment,
-		})
+		}
+		if comment.ParentID != nil {
+			parent, err := dbConn.GetComment(c.Context(), *comment.ParentID)
+			if err != nil {
+				slog.ErrorContext(c.Context(), err.Error())
+				return common.SendErrorResponse(c, http.StatusNotFound, "Parent comment not found")
+			}
+			if status, msg := checkReplyTo(parent, comment.RecipeID); status != 0 {
+				return common.SendErrorResponse(c, status, msg)
+			}
+			params.ParentID = pgtype.Int4{Int32: parent.ID, Valid: true}
+			params.Depth = parent.Depth + 1
+		}
+
+		createdComment, err := dbConn.AddComment(c.Context(), params)
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusBadRequest, "Failed to create comment.")
 		}
-		return c.Status(http.StatusCreated).JSON(createdComment)
+		metrics.CommentsPosted.Inc()
+
+		created := models.FromComment(createdComment, author, 0)
+		created.Reactions = map[string]int32{}
+		return c.Status(http.StatusCreated).JSON(created)
+	}
+}
+
+// checkReplyTo reports whether parent can be replied to from a comment on
+// recipeID. A non zero status means the reply must be rejected with the
+// returned message.
+func checkReplyTo(parent db.RecipeComment, recipeID int32) (int, string) {
+	if parent.RecipeID.Int32 != recipeID {
+		return http.StatusBadRequest, "Parent comment belongs to another recipe"
+	}
+	if parent.DeletedAt.Valid {
+		return http.StatusConflict, "Cannot reply to a deleted comment"
+	}
+	if parent.Depth >= MAX_COMMENT_DEPTH {
+		return http.StatusBadRequest, fmt.Sprintf("Replies cannot be nested more than %d levels deep", MAX_COMMENT_DEPTH)
+	}
+	return 0, ""
+}
+
+func listReplies(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		commentID, err := strconv.Atoi(c.Params("commentId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid Comment Id.")
+		}
+
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		cursorCreatedAt, cursorID := page.After()
+		userId, _ := c.Locals(logger.UserId).(int32)
+		replies, err := dbConn.ListCommentReplies(c.Context(), db.ListCommentRepliesParams{
+			ViewerID:        userId,
+			ParentID:        pgtype.Int4{Int32: int32(commentID), Valid: true},
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.Fetch(),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch replies")
+		}
+
+		rows := pagination.NewPage(page, replies, func(rc db.ListCommentRepliesRow) (pgtype.Timestamp, int32) {
+			return rc.RecipeComment.CreatedAt, rc.RecipeComment.ID
+		})
+		items := make([]models.Comment, len(rows.Items))
+		for i, rc := range rows.Items {
+			items[i], err = models.FromComment(rc.RecipeComment, rc.User, rc.ReplyCount).WithReactions(rc.Reactions, rc.MyReaction)
+			if err != nil {
+				slog.ErrorContext(c.Context(), err.Error())
+				return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch replies")
+			}
+		}
+
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
 	}
 }
 
@@ -54,28 +154,159 @@ func updateComment(dbConn *db.Queries) fiber.Handler {
 			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid input.")
 		}
 
-		err = dbConn.UpdateComment(c.Context(), db.UpdateCommentParams{
+		comment, err := dbConn.GetComment(c.Context(), int32(commentID))
+		if err != nil || comment.DeletedAt.Valid {
+			return common.SendErrorResponse(c, http.StatusNotFound, "Comment not found")
+		}
+		if comment.UserID.Int32 != c.Locals(logger.UserId).(int32) {
+			return common.SendErrorResponse(c, http.StatusForbidden, "Only the author can edit this comment")
+		}
+
+		updated, err := dbConn.UpdateComment(c.Context(), db.UpdateCommentParams{
 			ID:      int32(commentID),
 			Comment: updateData.Comment,
 		})
 		if err != nil {
 			return common.SendErrorResponse(c, http.StatusBadRequest, "Failed to update comment")
 		}
+		if updated == 0 {
+			return common.SendErrorResponse(c, http.StatusNotFound, "Comment not found")
+		}
 		return c.SendStatus(http.StatusNoContent)
 	}
 }
 
-func deleteComment(dbConn *db.Queries) fiber.Handler {
+// deleteWithEmptyAncestors deletes a comment without replies along with the
+// tombstoned ancestors only it was keeping around.
+func deleteWithEmptyAncestors(ctx context.Context, q *db.Queries, comment db.RecipeComment) error {
+	for {
+		if err := q.DeleteComment(ctx, comment.ID); err != nil {
+			return err
+		}
+		if !comment.ParentID.Valid {
+			return nil
+		}
+
+		parent, err := q.GetCommentForUpdate(ctx, comment.ParentID.Int32)
+		if err != nil {
+			return err
+		}
+		if !parent.DeletedAt.Valid {
+			return nil
+		}
+		hasReplies, err := q.HasCommentReplies(ctx, comment.ParentID)
+		if err != nil || hasReplies {
+			return err
+		}
+		comment = parent
+	}
+}
+
+// deleteComment removes a comment, or tombstones it when it has replies so
+// the thread below it is kept.
+func deleteComment(pool *pgxpool.Pool) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		commentID, err := strconv.Atoi(c.Params("commentId"))
 		if err != nil {
 			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid Comment Id.")
 		}
 
-		err = dbConn.DeleteComment(c.Context(), int32(commentID))
+		tx, err := pool.Begin(c.Context())
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to delete comment")
+		}
+		defer common.Rollback(c.Context(), tx)
+
+		// the row lock makes replies posted meanwhile wait for the deletion,
+		// so a comment is never removed from under a new reply
+		q := db.New(tx)
+		comment, err := q.GetCommentForUpdate(c.Context(), int32(commentID))
+		if err != nil || comment.DeletedAt.Valid {
+			return common.SendErrorResponse(c, http.StatusNotFound, "Comment not found")
+		}
+		if comment.UserID.Int32 != c.Locals(logger.UserId).(int32) {
+			return common.SendErrorResponse(c, http.StatusForbidden, "Only the author can delete this comment")
+		}
+
+		hasReplies, err := q.HasCommentReplies(c.Context(), pgtype.Int4{Int32: comment.ID, Valid: true})
 		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to delete comment")
 		}
+
+		if hasReplies {
+			err = q.TombstoneComment(c.Context(), comment.ID)
+		} else {
+			err = deleteWithEmptyAncestors(c.Context(), q, comment)
+		}
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to delete comment")
+		}
+
+		if err := tx.Commit(c.Context()); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction")
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// reactToComment sets the caller's reaction to a comment, replacing the one
+// they had.
+func reactToComment(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		commentID, err := strconv.Atoi(c.Params("commentId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid Comment Id.")
+		}
+
+		var body ReactBody
+		if err := c.Bind().JSON(&body); err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid input.")
+		}
+		if !slices.Contains(REACTIONS, body.Reaction) {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "reaction must be one of "+strings.Join(REACTIONS, ", "))
+		}
+
+		comment, err := dbConn.GetComment(c.Context(), int32(commentID))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusNotFound, "Comment not found")
+		}
+		if comment.DeletedAt.Valid {
+			return common.SendErrorResponse(c, http.StatusConflict, "Cannot react to a deleted comment")
+		}
+
+		err = dbConn.ReactToComment(c.Context(), db.ReactToCommentParams{
+			CommentID: comment.ID,
+			UserID:    c.Locals(logger.UserId).(int32),
+			Reaction:  body.Reaction,
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not react to the comment")
+		}
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+func deleteReaction(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		commentID, err := strconv.Atoi(c.Params("commentId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid Comment Id.")
+		}
+
+		err = dbConn.DeleteCommentReaction(c.Context(), db.DeleteCommentReactionParams{
+			CommentID: int32(commentID),
+			UserID:    c.Locals(logger.UserId).(int32),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not remove the reaction")
+		}
 		return c.SendStatus(http.StatusNoContent)
 	}
 }
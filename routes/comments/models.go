@@ -1,11 +1,26 @@
 package comments
 
+// REACTIONS are the reactions a comment can get, clients show them as emoji.
+var REACTIONS = []string{
+	"like",
+	"love",
+	"laugh",
+	"wow",
+	"sad",
+	"chai",
+}
+
 type CreateCommentBody struct {
 	RecipeID int32  `json:"recipeId"`
-	UserID   int32  `json:"userId"`
 	Comment  string `json:"comment"`
+	// ParentID is the comment replied to, nil for a top level comment.
+	ParentID *int32 `json:"parentId"`
 }
 
 type UpdateCommentBody struct {
 	Comment string `json:"comment"`
 }
+
+type ReactBody struct {
+	Reaction string `json:"reaction"`
+}
@@ -1,6 +1,16 @@
 package routes
 
-import "github.com/gofiber/fiber/v3"
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"ChaiwalaBackend/db"
+	"ChaiwalaBackend/models"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5"
+)
 
 type Error struct {
 	Message   string `json:"message"`
@@ -15,3 +25,50 @@ func SendErrorResponse(c fiber.Ctx, statusCode int, message string) error {
 		},
 	)
 }
+
+// Rollback is meant to be deferred right after beginning a transaction, it
+// is a no-op once the transaction has been committed.
+func Rollback(ctx context.Context, tx pgx.Tx) {
+	if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		slog.ErrorContext(ctx, err.Error())
+	}
+}
+
+// FavoritedRecipes returns which of recipeIds userId has favorited.
+func FavoritedRecipes(ctx context.Context, dbConn *db.Queries, userId int32, recipeIds []int32) (map[int32]bool, error) {
+	favorited := make(map[int32]bool, len(recipeIds))
+	if len(recipeIds) == 0 {
+		return favorited, nil
+	}
+
+	ids, err := dbConn.ListFavoritedRecipeIds(ctx, db.ListFavoritedRecipeIdsParams{
+		UserID:    userId,
+		RecipeIds: recipeIds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		favorited[id] = true
+	}
+	return favorited, nil
+}
+
+// SummarizeRecipes converts recipes for a list shown to userId.
+func SummarizeRecipes(ctx context.Context, dbConn *db.Queries, userId int32, recipes []db.Recipe) ([]models.RecipeSummary, error) {
+	ids := make([]int32, len(recipes))
+	for i, r := range recipes {
+		ids[i] = r.ID
+	}
+
+	favorited, err := FavoritedRecipes(ctx, dbConn, userId, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]models.RecipeSummary, len(recipes))
+	for i, r := range recipes {
+		summaries[i] = models.RecipeSummary{Recipe: models.FromRecipe(r), FavoritedByMe: favorited[r.ID]}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,79 @@
+package feed
+
+import (
+	"log/slog"
+	"net/http"
+
+	"ChaiwalaBackend/db"
+	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/pagination"
+	common "ChaiwalaBackend/routes"
+	"ChaiwalaBackend/trending"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// POPULAR_LIMIT is how many of the top trending recipes are mixed into every
+// feed.
+const POPULAR_LIMIT = 20
+
+func BuildRouter(app *fiber.App, dbConn *db.Queries, windows trending.Windows) *fiber.Router {
+	feedRouter := app.Group("/feed")
+
+	window, _ := windows.Find("")
+	feedRouter.Get("", getFeed(dbConn, window))
+
+	return &feedRouter
+}
+
+// getFeed is built on read from the follows of the user, newest first.
+func getFeed(dbConn *db.Queries, window trending.Window) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		userId := c.Locals(logger.UserId).(int32)
+		cursorCreatedAt, cursorID := page.After()
+		feed, err := dbConn.ListFeed(c.Context(), db.ListFeedParams{
+			UserID:          userId,
+			TrendingWindow:  window.Name,
+			PopularLimit:    POPULAR_LIMIT,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.Fetch(),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch feed")
+		}
+
+		rows := pagination.NewPage(page, feed, func(f db.ListFeedRow) (pgtype.Timestamp, int32) {
+			return f.Recipe.CreatedAt, f.Recipe.ID
+		})
+
+		recipes := make([]db.Recipe, len(rows.Items))
+		for i, f := range rows.Items {
+			recipes[i] = f.Recipe
+		}
+		summaries, err := common.SummarizeRecipes(c.Context(), dbConn, userId, recipes)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch feed")
+		}
+
+		items := make([]FeedItem, len(summaries))
+		for i, s := range summaries {
+			items[i] = FeedItem{RecipeSummary: s, Reason: REASON_TRENDING}
+			if rows.Items[i].FromFollowing {
+				items[i].Reason = REASON_FOLLOWING
+			}
+		}
+
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
+	}
+}
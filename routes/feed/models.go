@@ -0,0 +1,15 @@
+package feed
+
+import "ChaiwalaBackend/models"
+
+const (
+	REASON_FOLLOWING = "following"
+	REASON_TRENDING  = "trending"
+)
+
+type FeedItem struct {
+	models.RecipeSummary
+	// Reason is why the recipe is in the feed, REASON_FOLLOWING or
+	// REASON_TRENDING.
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"ChaiwalaBackend/buildinfo"
+	"ChaiwalaBackend/clients/s3"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func BuildRouter(app *fiber.App, pool *pgxpool.Pool, s3Client s3.S3Client, timeout, cacheTTL time.Duration) {
+	checker := &readinessChecker{
+		checks: map[string]func(context.Context) error{
+			"postgres": pool.Ping,
+			"s3":       s3Client.Ping,
+		},
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+	}
+
+	app.Get("/healthz", liveness())
+	app.Get("/readyz", readiness(checker))
+	app.Get("/version", version())
+}
+
+func liveness() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": STATUS_OK})
+	}
+}
+
+func readiness(checker *readinessChecker) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		report := checker.check(c.Context())
+		if report.Status != STATUS_OK {
+			return c.Status(http.StatusServiceUnavailable).JSON(report)
+		}
+		return c.JSON(report)
+	}
+}
+
+func version() fiber.Handler {
+	info := buildinfo.Get()
+	return func(c fiber.Ctx) error {
+		return c.JSON(info)
+	}
+}
+
+type readinessChecker struct {
+	checks   map[string]func(context.Context) error
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	last      Report
+}
+
+// check runs every dependency check concurrently, each bounded by the timeout.
+// Results are cached for cacheTTL so frequent probes don't hammer the dependencies.
+func (r *readinessChecker) check(ctx context.Context) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.checkedAt.IsZero() && time.Since(r.checkedAt) < r.cacheTTL {
+		return r.last
+	}
+
+	report := Report{Status: STATUS_OK, Checks: make(map[string]Check, len(r.checks))}
+
+	var (
+		wg  sync.WaitGroup
+		rmu sync.Mutex
+	)
+	for name, fn := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := fn(cctx)
+			result := Check{Status: STATUS_OK, Duration: time.Since(start).String()}
+			if err != nil {
+				slog.ErrorContext(ctx, "readiness check failed", slog.String("check", name), slog.String("error", err.Error()))
+				result.Status = STATUS_FAIL
+			}
+
+			rmu.Lock()
+			defer rmu.Unlock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = STATUS_FAIL
+			}
+		}()
+	}
+	wg.Wait()
+
+	report.CheckedAt = time.Now().UTC()
+	r.checkedAt = time.Now()
+	r.last = report
+
+	return report
+}
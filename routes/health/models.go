@@ -0,0 +1,21 @@
+package health
+
+import "time"
+
+const (
+	STATUS_OK   = "ok"
+	STATUS_FAIL = "fail"
+)
+
+// Check only reports ok or fail, the failure detail is logged server side so
+// hosts and driver errors are not exposed to unauthenticated callers.
+type Check struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+}
+
+type Report struct {
+	Status    string           `json:"status"`
+	Checks    map[string]Check `json:"checks"`
+	CheckedAt time.Time        `json:"checkedAt"`
+}
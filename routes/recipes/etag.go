@@ -0,0 +1,58 @@
+package recipes
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// recipeETag is a strong validator for a recipe, derived from its version.
+// It covers what the author can edit and is what edit responses send.
+func recipeETag(version int32) string {
+	return `"` + strconv.Itoa(int(version)) + `"`
+}
+
+// detailETag is a strong validator for the recipe detail as one viewer sees
+// it. Counters and the viewer's own state change it without bumping the
+// version, so they are hashed into a suffix after the version.
+func detailETag(version int32, state ...any) string {
+	h := fnv.New64a()
+	for _, s := range state {
+		fmt.Fprintf(h, "%v\x00", s)
+	}
+	return fmt.Sprintf(`"%d-%x"`, version, h.Sum64())
+}
+
+// etagMatchesWeak reports whether an If-None-Match header value matches etag
+// using weak comparison. The header may list several tags or be "*". Weak
+// tags are compared by their opaque value.
+func etagMatchesWeak(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchesVersion reports whether an If-Match header value names version.
+// Comparison is strong, weak tags never match. Only the version part of a
+// detail tag is compared, counters changing meanwhile are no edit conflict.
+func ifMatchesVersion(header string, version int32) bool {
+	want := strconv.Itoa(int(version))
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if v, _, _ := strings.Cut(tag[1:len(tag)-1], "-"); v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package recipes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ChaiwalaBackend/db"
+	"ChaiwalaBackend/pagination"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	SORT_NEWEST    = "newest"
+	SORT_FAVORITES = "favorites"
+	SORT_COMMENTS  = "comments"
+	SORT_QUICKEST  = "quickest"
+	SORT_RATING    = "rating"
+)
+
+// Comment orderings, newest is shared with recipes.
+const SORT_TOP = "top"
+
+// RATING_PRIOR_WEIGHT is how many site average ratings a recipe is assumed to
+// have when sorting by rating.
+const RATING_PRIOR_WEIGHT = 10
+
+// recipeFilters are the listing filters shared by FilterPublicRecipes and
+// its tea type facet counts.
+type recipeFilters struct {
+	teaTypes     []int32
+	maxPrepTime  pgtype.Int4
+	minServings  pgtype.Int4
+	maxServings  pgtype.Int4
+	authorID     pgtype.Int4
+	createdAfter pgtype.Timestamp
+	hasImage     pgtype.Bool
+	sort         string
+}
+
+// parseRecipeFilters reads the listing filters from the query string, teaType
+// may be repeated or comma separated.
+func parseRecipeFilters(c fiber.Ctx) (recipeFilters, error) {
+	f := recipeFilters{teaTypes: []int32{}, sort: SORT_NEWEST}
+
+	for _, raw := range c.Request().URI().QueryArgs().PeekMulti("teaType") {
+		for _, v := range strings.Split(string(raw), ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || TeaType(n).String() == "Unknown" {
+				return f, fmt.Errorf("Invalid teaType %q", v)
+			}
+			f.teaTypes = append(f.teaTypes, int32(n))
+		}
+	}
+
+	var err error
+	if f.maxPrepTime, err = queryInt(c, "maxPrepTime"); err != nil {
+		return f, err
+	}
+	if f.minServings, err = queryInt(c, "minServings"); err != nil {
+		return f, err
+	}
+	if f.maxServings, err = queryInt(c, "maxServings"); err != nil {
+		return f, err
+	}
+	if f.authorID, err = queryInt(c, "author"); err != nil {
+		return f, err
+	}
+
+	if v := c.Query("createdAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, v)
+		}
+		if err != nil {
+			return f, fmt.Errorf("createdAfter must be a date or an RFC 3339 timestamp")
+		}
+		f.createdAfter = pgtype.Timestamp{Time: t.UTC(), Valid: true}
+	}
+
+	if v := c.Query("hasImage"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("hasImage must be true or false")
+		}
+		f.hasImage = pgtype.Bool{Bool: b, Valid: true}
+	}
+
+	switch sort := c.Query("sort", SORT_NEWEST); sort {
+	case SORT_NEWEST, SORT_FAVORITES, SORT_COMMENTS, SORT_QUICKEST, SORT_RATING:
+		f.sort = sort
+	default:
+		return f, fmt.Errorf("sort must be one of %s, %s, %s, %s or %s", SORT_NEWEST, SORT_FAVORITES, SORT_COMMENTS, SORT_QUICKEST, SORT_RATING)
+	}
+
+	return f, nil
+}
+
+func queryInt(c fiber.Ctx, key string) (pgtype.Int4, error) {
+	v := c.Query(key)
+	if v == "" {
+		return pgtype.Int4{}, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return pgtype.Int4{}, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return pgtype.Int4{Int32: int32(n), Valid: true}, nil
+}
+
+// listParams pages by keyset when sorting by newest and by offset otherwise.
+func (f recipeFilters) listParams(page pagination.Request) db.FilterPublicRecipesParams {
+	params := db.FilterPublicRecipesParams{
+		MaxPrepTime:       f.maxPrepTime,
+		MinServings:       f.minServings,
+		MaxServings:       f.maxServings,
+		AuthorID:          f.authorID,
+		CreatedAfter:      f.createdAfter,
+		HasImage:          f.hasImage,
+		TeaTypes:          f.teaTypes,
+		Sort:              f.sort,
+		PageLimit:         page.Fetch(),
+		RatingPriorWeight: RATING_PRIOR_WEIGHT,
+	}
+	if f.sort == SORT_NEWEST {
+		params.CursorCreatedAt, params.CursorID = page.After()
+	} else {
+		params.PageOffset = page.Offset()
+	}
+	return params
+}
+
+func (f recipeFilters) facetParams() db.CountPublicRecipesByTeaTypeParams {
+	return db.CountPublicRecipesByTeaTypeParams{
+		MaxPrepTime:  f.maxPrepTime,
+		MinServings:  f.minServings,
+		MaxServings:  f.maxServings,
+		AuthorID:     f.authorID,
+		CreatedAfter: f.createdAfter,
+		HasImage:     f.hasImage,
+	}
+}
+
+// teaTypeFacets lists every tea type with its count, including empty ones.
+func teaTypeFacets(rows []db.CountPublicRecipesByTeaTypeRow) []TeaTypeFacet {
+	facets := make([]TeaTypeFacet, len(TEANAMES))
+	for i, name := range TEANAMES {
+		facets[i] = TeaTypeFacet{TeaType: TeaType(i), Name: name}
+	}
+	for _, r := range rows {
+		if TeaType(r.Type).String() != "Unknown" {
+			facets[r.Type].Count = r.Count
+		}
+	}
+	return facets
+}
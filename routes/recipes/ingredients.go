@@ -0,0 +1,74 @@
+package recipes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ChaiwalaBackend/db"
+	"ChaiwalaBackend/models"
+	"ChaiwalaBackend/units"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var errInvalidIngredients = errors.New("invalid ingredients")
+
+// canonicalIngredient is the dictionary form of an ingredient name, so
+// "Green Tea " and "green  tea" share an entry.
+func canonicalIngredient(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// saveIngredients replaces the ingredients of a recipe with want, in order,
+// adding unseen names to the ingredient dictionary.
+func saveIngredients(ctx context.Context, q *db.Queries, recipeID int32, want []models.Ingredient) error {
+	for i, in := range want {
+		if canonicalIngredient(in.Name) == "" {
+			return fmt.Errorf("%w: ingredient %d has no name", errInvalidIngredients, i+1)
+		}
+		if in.Quantity != nil && *in.Quantity < 0 {
+			return fmt.Errorf("%w: %s has a negative quantity", errInvalidIngredients, in.Name)
+		}
+	}
+
+	if err := q.DeleteRecipeIngredients(ctx, recipeID); err != nil {
+		return err
+	}
+
+	for i, in := range want {
+		ingredient, err := q.UpsertIngredient(ctx, canonicalIngredient(in.Name))
+		if err != nil {
+			return err
+		}
+
+		params := db.AddRecipeIngredientParams{
+			RecipeID:     recipeID,
+			IngredientID: ingredient.ID,
+			Position:     int32(i + 1),
+			Unit:         pgtype.Text{String: strings.TrimSpace(in.Unit), Valid: strings.TrimSpace(in.Unit) != ""},
+			Note:         pgtype.Text{String: in.Note, Valid: in.Note != ""},
+		}
+		if in.Quantity != nil {
+			params.Quantity = pgtype.Float8{Float64: *in.Quantity, Valid: true}
+		}
+		if _, err := q.AddRecipeIngredient(ctx, params); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// adjustIngredients scales quantities by factor and converts them to system.
+func adjustIngredients(ingredients []models.Ingredient, factor float64, system units.System) {
+	for i, in := range ingredients {
+		if in.Quantity == nil {
+			continue
+		}
+		q := units.Convert(units.Scale(units.Quantity{Amount: *in.Quantity, Unit: in.Unit}, factor), system)
+		ingredients[i].Quantity = &q.Amount
+		ingredients[i].Unit = q.Unit
+	}
+}
@@ -1,6 +1,17 @@
 package recipes
 
-import "ChaiwalaBackend/db"
+import (
+	"time"
+
+	"ChaiwalaBackend/models"
+	"ChaiwalaBackend/pagination"
+)
+
+// MAX_SERVINGS bounds the servings a recipe can be scaled to.
+const MAX_SERVINGS = 100
+
+// MAX_TITLE_LENGTH matches the VARCHAR(100) title column.
+const MAX_TITLE_LENGTH = 100
 
 type TeaType int32
 
@@ -55,33 +66,78 @@ type SavedStep struct {
 	Step
 }
 
+type ReorderStepsBody struct {
+	StepIds []int32 `json:"stepIds"`
+}
+
 type CreateRecipeBody struct {
-	Title           string `json:"title"`
-	Description     string `json:"description"`
-	TeaType         int    `json:"teaType"`
-	Steps           []Step `json:"steps"`
-	AssetId         string `json:"assetId"`
-	PrepTimeMinutes int32  `json:"prepTimeMinutes"`
-	Servings        int32  `json:"servings"`
-	IsPublic        bool   `json:"isPublic"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	TeaType     int    `json:"teaType"`
+	// Steps are numbered in order, their stepNumber is ignored.
+	Steps           []Step              `json:"steps"`
+	Ingredients     []models.Ingredient `json:"ingredients"`
+	AssetId         string              `json:"assetId"`
+	PrepTimeMinutes int32               `json:"prepTimeMinutes"`
+	Servings        int32               `json:"servings"`
+	IsPublic        bool                `json:"isPublic"`
 }
 
 type UpdateRecipeBody struct {
-	Title           string          `json:"title"`
-	Description     string          `json:"description"`
-	Steps           []db.RecipeStep `json:"steps"`
-	TeaType         int             `json:"teaType"`
-	AssetID         string          `json:"assetId"`
-	PrepTimeMinutes int32           `json:"prepTimeMinutes"`
-	Servings        int32           `json:"servings"`
-	IsPublic        bool            `json:"isPublic"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Steps replaces the recipe's steps in order, steps without an id are
+	// added and missing ones removed. Omitting it leaves the steps as they are.
+	Steps []SavedStep `json:"steps"`
+	// Ingredients replaces the recipe's ingredients, omitting it leaves them
+	// as they are.
+	Ingredients     []models.Ingredient `json:"ingredients"`
+	TeaType         int                 `json:"teaType"`
+	AssetID         string              `json:"assetId"`
+	PrepTimeMinutes int32               `json:"prepTimeMinutes"`
+	Servings        int32               `json:"servings"`
+	IsPublic        bool                `json:"isPublic"`
+}
+
+type RateRecipeBody struct {
+	Stars int32 `json:"stars"`
+	// Review is optional, an empty review removes the previous one.
+	Review string `json:"review"`
+}
+
+type Review struct {
+	models.Rating
+	Author models.User `json:"author"`
+}
+
+type SearchResult struct {
+	ID        int32     `json:"id"`
+	UserID    int32     `json:"userId"`
+	Title     string    `json:"title"`
+	TeaType   TeaType   `json:"teaType"`
+	AssetID   string    `json:"assetId"`
+	CreatedAt time.Time `json:"createdAt"`
+	Rank      float32   `json:"rank"`
+	// Snippet is HTML escaped with matches wrapped in <mark> tags.
+	Snippet string `json:"snippet"`
+}
+
+type TeaTypeFacet struct {
+	TeaType TeaType `json:"teaType"`
+	Name    string  `json:"name"`
+	Count   int64   `json:"count"`
+}
+
+type RecipeFacets struct {
+	TeaTypes []TeaTypeFacet `json:"teaTypes"`
+}
+
+type RecipeList struct {
+	pagination.Page[models.RecipeSummary]
+	Facets RecipeFacets `json:"facets"`
 }
 
-type GetRecipe struct {
-	ID             int32           `json:"id"`
-	Recipe         db.Recipe       `json:"recipe"`
-	CreatedBy      db.User         `json:"createdBy"`
-	Steps          []db.RecipeStep `json:"steps"`
-	CommentsCount  int32           `json:"commentsCount"`
-	FavoritesCount int32           `json:"favoritesCount"`
+type TrendingRecipe struct {
+	models.RecipeSummary
+	Score float64 `json:"score"`
 }
@@ -0,0 +1,170 @@
+package recipes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"ChaiwalaBackend/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	MERGE_PATCH_CONTENT_TYPE = "application/merge-patch+json"
+	JSON_PATCH_CONTENT_TYPE  = "application/json-patch+json"
+)
+
+var errTitleTooLong = fmt.Errorf("title cannot be longer than %d characters", MAX_TITLE_LENGTH)
+
+// titleTooLong reports whether title exceeds the title column, which counts
+// characters rather than bytes.
+func titleTooLong(title string) bool {
+	return utf8.RuneCountInString(title) > MAX_TITLE_LENGTH
+}
+
+// jsonPatchOp is a single RFC 6902 operation. Only add, replace and remove on
+// top level recipe fields are supported.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// mergePatch is an RFC 7386 document, a null member removes the field.
+type mergePatch map[string]json.RawMessage
+
+// parsePatch decodes body into a merge patch, converting JSON Patch
+// documents so both formats share the same validation.
+func parsePatch(contentType string, body []byte) (mergePatch, error) {
+	if strings.HasPrefix(contentType, JSON_PATCH_CONTENT_TYPE) {
+		var ops []jsonPatchOp
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return nil, errors.New("Patch must be an array of operations")
+		}
+		return opsToMergePatch(ops)
+	}
+
+	var patch mergePatch
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return nil, errors.New("Patch must be a JSON object")
+	}
+	return patch, nil
+}
+
+func opsToMergePatch(ops []jsonPatchOp) (mergePatch, error) {
+	patch := mergePatch{}
+	for _, op := range ops {
+		field, ok := strings.CutPrefix(op.Path, "/")
+		if !ok || field == "" || strings.Contains(field, "/") {
+			return nil, fmt.Errorf("Unsupported patch path %q", op.Path)
+		}
+
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				return nil, fmt.Errorf("Missing value for %s %q", op.Op, op.Path)
+			}
+			patch[field] = op.Value
+		case "remove":
+			patch[field] = json.RawMessage("null")
+		default:
+			return nil, fmt.Errorf("Unsupported patch operation %q", op.Op)
+		}
+	}
+	return patch, nil
+}
+
+// toParams validates the patch against the recipe fields and builds the
+// PatchRecipe params for recipe id.
+func (p mergePatch) toParams(id int32) (db.PatchRecipeParams, error) {
+	params := db.PatchRecipeParams{ID: id}
+
+	for field, raw := range p {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		var err error
+		switch field {
+		case "title":
+			err = requiredText(raw, isNull, field, &params.Title)
+			if err == nil && params.Title.String == "" {
+				err = errors.New("title cannot be empty")
+			}
+			if err == nil && titleTooLong(params.Title.String) {
+				err = errTitleTooLong
+			}
+		case "description":
+			err = requiredText(raw, isNull, field, &params.Description)
+		case "assetId":
+			// asset_id is not nullable, removing it clears the asset
+			if isNull {
+				params.AssetID = pgtype.Text{String: "", Valid: true}
+				continue
+			}
+			err = requiredText(raw, isNull, field, &params.AssetID)
+		case "teaType":
+			if isNull {
+				err = errors.New("teaType cannot be removed")
+				break
+			}
+			var t TeaType
+			if json.Unmarshal(raw, &t) != nil || t.String() == "Unknown" {
+				err = errors.New("teaType is not a valid tea type")
+				break
+			}
+			params.Type = pgtype.Int4{Int32: int32(t), Valid: true}
+		case "prepTimeMinutes":
+			params.SetPrepTimeMinutes = true
+			err = optionalInt(raw, isNull, field, &params.PrepTimeMinutes)
+		case "servings":
+			params.SetServings = true
+			err = optionalInt(raw, isNull, field, &params.Servings)
+		case "isPublic":
+			if isNull {
+				err = errors.New("isPublic cannot be removed")
+				break
+			}
+			var b bool
+			if json.Unmarshal(raw, &b) != nil {
+				err = errors.New("isPublic must be a boolean")
+				break
+			}
+			params.IsPublic = pgtype.Bool{Bool: b, Valid: true}
+		default:
+			err = fmt.Errorf("%s cannot be patched", field)
+		}
+		if err != nil {
+			return params, err
+		}
+	}
+
+	return params, nil
+}
+
+func requiredText(raw json.RawMessage, isNull bool, field string, dst *pgtype.Text) error {
+	if isNull {
+		return fmt.Errorf("%s cannot be removed", field)
+	}
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		return fmt.Errorf("%s must be a string", field)
+	}
+	*dst = pgtype.Text{String: s, Valid: true}
+	return nil
+}
+
+func optionalInt(raw json.RawMessage, isNull bool, field string, dst *pgtype.Int4) error {
+	if isNull {
+		*dst = pgtype.Int4{}
+		return nil
+	}
+	var n int32
+	if json.Unmarshal(raw, &n) != nil || n < 0 {
+		return fmt.Errorf("%s must be a non-negative integer", field)
+	}
+	*dst = pgtype.Int4{Int32: n, Valid: true}
+	return nil
+}
@@ -0,0 +1,132 @@
+package recipes
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ChaiwalaBackend/db"
+	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/models"
+	"ChaiwalaBackend/pagination"
+	common "ChaiwalaBackend/routes"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func buildRatingsRouter(recipeRouter fiber.Router, dbConn *db.Queries) {
+	recipeRouter.Put("/:recipeId/rating", rateRecipe(dbConn))
+	recipeRouter.Delete("/:recipeId/rating", deleteRating(dbConn))
+	recipeRouter.Get("/:recipeId/reviews", listReviews(dbConn))
+}
+
+// rateRecipe creates or replaces the caller's rating of a recipe. Authors
+// cannot rate their own recipes and private recipes cannot be rated.
+func rateRecipe(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		recipeID, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+
+		var body RateRecipeBody
+		if err := c.Bind().JSON(&body); err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid input")
+		}
+		if body.Stars < 1 || body.Stars > 5 {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "stars must be between 1 and 5")
+		}
+
+		recipe, err := dbConn.GetRecipe(c.Context(), int32(recipeID))
+		if err != nil || !recipe.IsPublic.Bool {
+			return common.SendErrorResponse(c, http.StatusNotFound, "Recipe not found")
+		}
+
+		userId := c.Locals(logger.UserId).(int32)
+		if recipe.UserID.Int32 == userId {
+			return common.SendErrorResponse(c, http.StatusForbidden, "You cannot rate your own recipe")
+		}
+
+		review := strings.TrimSpace(body.Review)
+		rating, err := dbConn.RateRecipe(c.Context(), db.RateRecipeParams{
+			UserID:   userId,
+			RecipeID: recipe.ID,
+			Stars:    body.Stars,
+			Review:   pgtype.Text{String: review, Valid: review != ""},
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not rate the recipe")
+		}
+
+		return c.JSON(models.FromRating(rating))
+	}
+}
+
+func deleteRating(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		recipeID, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+
+		err = dbConn.DeleteRating(c.Context(), db.DeleteRatingParams{
+			UserID:   c.Locals(logger.UserId).(int32),
+			RecipeID: int32(recipeID),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not delete the rating")
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// listReviews lists the ratings of a recipe that come with a review. Private
+// recipes are only visible to their author.
+func listReviews(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		recipeID, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+
+		userId, _ := c.Locals(logger.UserId).(int32)
+		recipe, err := dbConn.GetRecipe(c.Context(), int32(recipeID))
+		if err != nil || (!recipe.IsPublic.Bool && recipe.UserID.Int32 != userId) {
+			return common.SendErrorResponse(c, http.StatusNotFound, "Recipe not found")
+		}
+
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		cursorCreatedAt, cursorID := page.After()
+		reviews, err := dbConn.ListRecipeReviews(c.Context(), db.ListRecipeReviewsParams{
+			RecipeID:        int32(recipeID),
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.Fetch(),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch reviews")
+		}
+
+		rows := pagination.NewPage(page, reviews, func(r db.ListRecipeReviewsRow) (pgtype.Timestamp, int32) {
+			return r.Rating.UpdatedAt, r.Rating.UserID
+		})
+		items := make([]Review, len(rows.Items))
+		for i, r := range rows.Items {
+			items[i] = Review{Rating: models.FromRating(r.Rating), Author: models.FromUser(r.User)}
+		}
+
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
+	}
+}
@@ -1,28 +1,45 @@
 package recipes
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"ChaiwalaBackend/db"
 	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/metrics"
+	"ChaiwalaBackend/models"
+	"ChaiwalaBackend/pagination"
 	common "ChaiwalaBackend/routes"
+	"ChaiwalaBackend/trending"
+	"ChaiwalaBackend/units"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func BuildRouter(app *fiber.App, conn *pgx.Conn, dbConn *db.Queries) *fiber.Router {
+func BuildRouter(app *fiber.App, pool *pgxpool.Pool, dbConn *db.Queries, windows trending.Windows) *fiber.Router {
 	recipeRouter := app.Group("/recipes")
 
 	recipeRouter.Get("", listPublicRecipes(dbConn))
+	recipeRouter.Get("/search", searchRecipes(dbConn))
+	recipeRouter.Get("/trending", listTrendingRecipes(dbConn, windows))
 	recipeRouter.Get("/:recipeId", getRecipeByID(dbConn))
-	recipeRouter.Post("", createRecipe(conn))
-	recipeRouter.Put("/:recipeId", updateRecipe(conn))
+	recipeRouter.Post("", createRecipe(pool))
+	recipeRouter.Put("/:recipeId", updateRecipe(pool))
+	recipeRouter.Patch("/:recipeId", patchRecipe(pool))
 	recipeRouter.Delete("/:recipeId", deleteRecipe(dbConn))
 
+	buildStepsRouter(recipeRouter, pool, dbConn)
+
+	buildRatingsRouter(recipeRouter, dbConn)
+
 	recipeRouter.Get("/:recipeId/comments", listRecipeComments(dbConn))
 
 	return &recipeRouter
@@ -30,57 +47,165 @@ func BuildRouter(app *fiber.App, conn *pgx.Conn, dbConn *db.Queries) *fiber.Rout
 
 func listPublicRecipes(dbConn *db.Queries) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		qParams := c.Queries()
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
 
-		offset := qParams["offset"]
-		limit := qParams["limit"]
+		filters, err := parseRecipeFilters(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		recipes, err := dbConn.FilterPublicRecipes(c.Context(), filters.listParams(page))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipes")
+		}
 
-		if offset == "" {
-			offset = "0"
+		counts, err := dbConn.CountPublicRecipesByTeaType(c.Context(), filters.facetParams())
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipes")
 		}
 
-		if limit == "" {
-			limit = "10"
+		var rows pagination.Page[db.Recipe]
+		if filters.sort == SORT_NEWEST {
+			rows = pagination.NewPage(page, recipes, func(r db.Recipe) (pgtype.Timestamp, int32) {
+				return r.CreatedAt, r.ID
+			})
+		} else {
+			rows = pagination.NewOffsetPage(page, recipes)
 		}
 
-		offsetInt, err := strconv.Atoi(offset)
+		userId, _ := c.Locals(logger.UserId).(int32)
+		summaries, err := common.SummarizeRecipes(c.Context(), dbConn, userId, rows.Items)
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
-			return common.SendErrorResponse(c, http.StatusUnprocessableEntity, "Invalid offset")
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipes")
+		}
+
+		list := RecipeList{
+			Page:   pagination.WithItems(rows, summaries),
+			Facets: RecipeFacets{TeaTypes: teaTypeFacets(counts)},
 		}
 
-		if offsetInt < 0 {
-			return common.SendErrorResponse(c, http.StatusBadRequest, "Offset must be greater than or equal to 0")
+		pagination.SetLinkHeader(c, list.NextCursor)
+		return c.JSON(list)
+	}
+}
+
+// listTrendingRecipes serves the rankings precomputed by trending.Refresh for
+// a window, optionally of a single tea type.
+func listTrendingRecipes(dbConn *db.Queries, windows trending.Windows) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		window, ok := windows.Find(c.Query("window"))
+		if !ok {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "window must be one of "+windows.String())
+		}
+
+		var teaType pgtype.Int4
+		if v := c.Query("teaType"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || TeaType(n).String() == "Unknown" {
+				return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid teaType")
+			}
+			teaType = pgtype.Int4{Int32: int32(n), Valid: true}
+		}
+
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
 		}
 
-		limitInt, err := strconv.Atoi(limit)
+		trendingRows, err := dbConn.ListTrendingRecipes(c.Context(), db.ListTrendingRecipesParams{
+			WindowName: window.Name,
+			TeaType:    teaType,
+			PageLimit:  page.Fetch(),
+			PageOffset: page.Offset(),
+		})
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
-			return common.SendErrorResponse(c, http.StatusUnprocessableEntity, "Invalid limit")
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch trending recipes")
 		}
-		if limitInt < 1 {
-			return common.SendErrorResponse(c, http.StatusBadRequest, "Limit must be greater than 0")
+
+		rows := pagination.NewOffsetPage(page, trendingRows)
+		recipes := make([]db.Recipe, len(rows.Items))
+		for i, r := range rows.Items {
+			recipes[i] = r.Recipe
 		}
-		if limitInt > 500 {
-			return common.SendErrorResponse(c, http.StatusBadRequest, "Limit must be less than 500")
+
+		userId, _ := c.Locals(logger.UserId).(int32)
+		summaries, err := common.SummarizeRecipes(c.Context(), dbConn, userId, recipes)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch trending recipes")
+		}
+
+		items := make([]TrendingRecipe, len(summaries))
+		for i, s := range summaries {
+			items[i] = TrendingRecipe{RecipeSummary: s, Score: rows.Items[i].Score}
 		}
 
-		recipes, err := dbConn.ListPublicRecipesPaginated(c.Context(), db.ListPublicRecipesPaginatedParams{
-			Limit:  int32(limitInt),
-			Offset: int32(offsetInt),
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
+	}
+}
+
+// searchRecipes ranks the recipes visible to the user against q, which
+// accepts web search syntax like "masala -sugar" or "\"green tea\"".
+func searchRecipes(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Query parameter q is required")
+		}
+
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		userId, _ := c.Locals(logger.UserId).(int32)
+		rows, err := dbConn.SearchRecipes(c.Context(), db.SearchRecipesParams{
+			Query:      query,
+			UserID:     userId,
+			PageLimit:  page.Fetch(),
+			PageOffset: page.Offset(),
 		})
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
-			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipes")
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to search recipes")
 		}
 
-		if recipes == nil {
-			return c.JSON([]db.Recipe{})
+		found := make([]SearchResult, 0, len(rows))
+		for _, r := range rows {
+			found = append(found, SearchResult{
+				ID:        r.ID,
+				UserID:    r.UserID.Int32,
+				Title:     r.Title,
+				TeaType:   TeaType(r.Type),
+				AssetID:   r.AssetID,
+				CreatedAt: r.CreatedAt.Time,
+				Rank:      r.Rank,
+				Snippet:   highlight(r.Snippet),
+			})
 		}
-		return c.JSON(recipes)
+		results := pagination.NewOffsetPage(page, found)
+		pagination.SetLinkHeader(c, results.NextCursor)
+		return c.JSON(results)
 	}
 }
 
+// highlightMarks turns the markers SearchRecipes puts around matches into
+// <mark> tags once the user supplied text has been escaped.
+var highlightMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+func highlight(snippet string) string {
+	return highlightMarks.Replace(html.EscapeString(snippet))
+}
+
 func getRecipeByID(dbConn *db.Queries) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("recipeId"))
@@ -89,41 +214,80 @@ func getRecipeByID(dbConn *db.Queries) fiber.Handler {
 			return common.SendErrorResponse(c, http.StatusUnprocessableEntity, "Invalid Request ID")
 		}
 
-		recipe, err := dbConn.GetRecipe(c.Context(), int32(id))
+		system, err := units.ParseSystem(c.Query("units"))
 		if err != nil {
-			slog.ErrorContext(c.Context(), err.Error())
-			return common.SendErrorResponse(c, http.StatusNotFound, "Recipe not found")
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+		servings := fiber.Query[int](c, "servings")
+		if c.Query("servings") != "" && (servings < 1 || servings > MAX_SERVINGS) {
+			return common.SendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("servings must be between 1 and %d", MAX_SERVINGS))
 		}
 
-		steps, err := dbConn.GetRecipeStepsByRecipe(c.Context(), pgtype.Int4{Int32: recipe.ID, Valid: true})
+		userId, _ := c.Locals(logger.UserId).(int32)
+		row, err := dbConn.GetRecipeDetail(c.Context(), db.GetRecipeDetailParams{
+			ID:       int32(id),
+			ViewerID: userId,
+		})
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
-			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipe steps")
+			return common.SendErrorResponse(c, http.StatusNotFound, "Recipe not found")
 		}
 
-		if steps == nil {
-			steps = []db.RecipeStep{}
+		if servings > 0 && (!row.Recipe.Servings.Valid || row.Recipe.Servings.Int32 < 1) {
+			return common.SendErrorResponse(c, http.StatusUnprocessableEntity, "Recipe has no servings to scale from")
 		}
 
-		user, err := dbConn.GetUser(c.Context(), recipe.UserID.Int32)
-		if err != nil {
+		etag := detailETag(
+			row.Recipe.Version,
+			row.Recipe.CommentsCount,
+			row.Recipe.FavoritesCount,
+			row.FavoritedByMe,
+			string(row.Author),
+			row.Recipe.RatingsCount,
+			row.Recipe.RatingsSum,
+			row.RatingDistribution,
+			row.MyRating,
+			// the scaled and converted variants differ from the plain recipe
+			servings,
+			system,
+		)
+		c.Set(fiber.HeaderETag, etag)
+		c.Vary(fiber.HeaderAuthorization)
+		if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" && etagMatchesWeak(ifNoneMatch, etag) {
+			return c.SendStatus(http.StatusNotModified)
+		}
+
+		detail := models.RecipeDetail{
+			Recipe:             models.FromRecipe(row.Recipe),
+			FavoritedByMe:      row.FavoritedByMe,
+			RatingDistribution: row.RatingDistribution,
+		}
+		if row.MyRating > 0 {
+			detail.MyRating = &row.MyRating
+		}
+		if err := errors.Join(
+			json.Unmarshal(row.Author, &detail.Author),
+			json.Unmarshal(row.Steps, &detail.Steps),
+			json.Unmarshal(row.Ingredients, &detail.Ingredients),
+		); err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
-			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch user")
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipe")
 		}
-		r := GetRecipe{
-			Recipe:         recipe,
-			Steps:          steps,
-			ID:             recipe.ID,
-			CommentsCount:  0,
-			FavoritesCount: 0,
-			CreatedBy:      user,
+
+		// a plain read returns the ingredients as stored, converting would
+		// round amounts and rename units
+		if servings > 0 {
+			adjustIngredients(detail.Ingredients, float64(servings)/float64(*detail.Servings), system)
+			detail.ScaledServings = int32(servings)
+		} else if system != units.ORIGINAL {
+			adjustIngredients(detail.Ingredients, 1, system)
 		}
 
-		return c.JSON(r)
+		return c.JSON(detail)
 	}
 }
 
-func createRecipe(conn *pgx.Conn) fiber.Handler {
+func createRecipe(pool *pgxpool.Pool) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		var r CreateRecipeBody
 		if err := c.Bind().JSON(&r); err != nil {
@@ -132,20 +296,17 @@ func createRecipe(conn *pgx.Conn) fiber.Handler {
 				RequestId: c.GetRespHeader("X-Request-ID"),
 			})
 		}
+		if titleTooLong(r.Title) {
+			return common.SendErrorResponse(c, http.StatusBadRequest, errTitleTooLong.Error())
+		}
 
-		tx, err := conn.Begin(c.Context())
+		tx, err := pool.Begin(c.Context())
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
 		}
 
-		defer func() {
-			if err != nil {
-				if rbErr := tx.Rollback(c.Context()); rbErr != nil {
-					slog.ErrorContext(c.Context(), err.Error())
-				}
-			}
-		}()
+		defer common.Rollback(c.Context(), tx)
 
 		q := db.New(tx)
 		userId := c.Locals(logger.UserId).(int32)
@@ -164,10 +325,12 @@ func createRecipe(conn *pgx.Conn) fiber.Handler {
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to create recipe")
 		}
 		slog.InfoContext(c.Context(), "scheduled recipe", slog.Int("recipeId", int(recipe.ID)))
-		for _, step := range r.Steps {
+		// steps are numbered by their position like syncSteps does, numbers
+		// sent by the client could collide and only fail at commit
+		for i, step := range r.Steps {
 			_, err := q.AddRecipeStep(c.Context(), db.AddRecipeStepParams{
 				RecipeID:    pgtype.Int4{Int32: recipe.ID, Valid: true},
-				StepNumber:  int32(step.StepNumber),
+				StepNumber:  int32(i + 1),
 				Description: step.Description,
 				AssetID:     pgtype.Text{String: step.AssetId, Valid: true},
 			})
@@ -178,44 +341,60 @@ func createRecipe(conn *pgx.Conn) fiber.Handler {
 		}
 		slog.InfoContext(c.Context(), "scheduled steps")
 
+		if err := saveIngredients(c.Context(), q, recipe.ID, r.Ingredients); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			if errors.Is(err, errInvalidIngredients) {
+				return common.SendErrorResponse(c, http.StatusUnprocessableEntity, err.Error())
+			}
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to create recipe")
+		}
+
 		err = tx.Commit(c.Context())
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction")
 		}
 
+		metrics.RecipesCreated.Inc()
 		slog.InfoContext(c.Context(), "success")
-		return c.Status(http.StatusCreated).JSON(recipe)
+		c.Set(fiber.HeaderETag, recipeETag(recipe.Version))
+		return c.Status(http.StatusCreated).JSON(models.FromRecipe(recipe))
 	}
 }
 
-func updateRecipe(conn *pgx.Conn) fiber.Handler {
+func updateRecipe(pool *pgxpool.Pool) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("recipeId"))
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
 		}
+		ifMatch := c.Get(fiber.HeaderIfMatch)
+		if ifMatch == "" {
+			return common.SendErrorResponse(c, http.StatusPreconditionRequired, "If-Match header with the recipe ETag is required")
+		}
+
 		var r UpdateRecipeBody
 		if err := c.Bind().JSON(&r); err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid input")
 		}
-		tx, err := conn.Begin(c.Context())
+		if titleTooLong(r.Title) {
+			return common.SendErrorResponse(c, http.StatusBadRequest, errTitleTooLong.Error())
+		}
+		tx, err := pool.Begin(c.Context())
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
 		}
-		defer func() {
-			if err != nil {
-				slog.ErrorContext(c.Context(), err.Error())
-				tx.Rollback(c.Context())
-			}
-		}()
+		defer common.Rollback(c.Context(), tx)
 
 		q := db.New(tx)
+		if status, msg := lockRecipeForEdit(c, q, int32(id)); status != 0 {
+			return common.SendErrorResponse(c, status, msg)
+		}
 
-		err = q.UpdateRecipe(c.Context(), db.UpdateRecipeParams{
+		version, err := q.UpdateRecipe(c.Context(), db.UpdateRecipeParams{
 			ID:              int32(id),
 			Title:           r.Title,
 			Description:     r.Description,
@@ -230,23 +409,98 @@ func updateRecipe(conn *pgx.Conn) fiber.Handler {
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to update recipe")
 		}
 
-		for _, step := range r.Steps {
-			err := q.UpdateRecipeStep(c.Context(), db.UpdateRecipeStepParams{
-				ID:          int32(step.ID),
-				StepNumber:  int32(step.StepNumber),
-				Description: step.Description,
-				AssetID:     step.AssetID,
-			})
-			if err != nil {
-				return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to update recipe step")
+		if r.Steps != nil {
+			if err := syncSteps(c.Context(), q, int32(id), r.Steps); err != nil {
+				slog.ErrorContext(c.Context(), err.Error())
+				if errors.Is(err, errInvalidSteps) {
+					return common.SendErrorResponse(c, http.StatusUnprocessableEntity, err.Error())
+				}
+				return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to update recipe steps")
+			}
+		}
+		if r.Ingredients != nil {
+			if err := saveIngredients(c.Context(), q, int32(id), r.Ingredients); err != nil {
+				slog.ErrorContext(c.Context(), err.Error())
+				if errors.Is(err, errInvalidIngredients) {
+					return common.SendErrorResponse(c, http.StatusUnprocessableEntity, err.Error())
+				}
+				return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to update recipe ingredients")
 			}
 		}
-		tx.Commit(c.Context())
+		if err := tx.Commit(c.Context()); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction")
+		}
 		slog.InfoContext(c.Context(), "Recipe updated successfully")
+		c.Set(fiber.HeaderETag, recipeETag(version))
 		return c.SendStatus(http.StatusNoContent)
 	}
 }
 
+// patchRecipe applies a JSON Merge Patch, or a JSON Patch limited to top level
+// fields, touching only the fields present in the document.
+func patchRecipe(pool *pgxpool.Pool) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+		ifMatch := c.Get(fiber.HeaderIfMatch)
+		if ifMatch == "" {
+			return common.SendErrorResponse(c, http.StatusPreconditionRequired, "If-Match header with the recipe ETag is required")
+		}
+
+		contentType := c.Get(fiber.HeaderContentType)
+		if !strings.HasPrefix(contentType, MERGE_PATCH_CONTENT_TYPE) &&
+			!strings.HasPrefix(contentType, JSON_PATCH_CONTENT_TYPE) &&
+			!strings.HasPrefix(contentType, fiber.MIMEApplicationJSON) {
+			c.Set("Accept-Patch", MERGE_PATCH_CONTENT_TYPE+", "+JSON_PATCH_CONTENT_TYPE)
+			return common.SendErrorResponse(c, http.StatusUnsupportedMediaType, "Unsupported patch format")
+		}
+
+		patch, err := parsePatch(contentType, c.Body())
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+		params, err := patch.toParams(int32(id))
+		if errors.Is(err, errTitleTooLong) {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusUnprocessableEntity, err.Error())
+		}
+
+		tx, err := pool.Begin(c.Context())
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
+		}
+		defer common.Rollback(c.Context(), tx)
+
+		q := db.New(tx)
+		if status, msg := lockRecipeForEdit(c, q, int32(id)); status != 0 {
+			return common.SendErrorResponse(c, status, msg)
+		}
+
+		recipe, err := q.PatchRecipe(c.Context(), params)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to update recipe")
+		}
+
+		if err := tx.Commit(c.Context()); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction")
+		}
+		slog.InfoContext(c.Context(), "Recipe patched successfully", slog.Int("fields", len(patch)))
+		c.Set(fiber.HeaderETag, recipeETag(recipe.Version))
+		return c.JSON(models.FromRecipe(recipe))
+	}
+}
+
 func deleteRecipe(dbConn *db.Queries) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("recipeId"))
@@ -264,6 +518,9 @@ func deleteRecipe(dbConn *db.Queries) fiber.Handler {
 	}
 }
 
+// listRecipeComments lists the top level comments of a recipe, newest first or
+// by most reactions with sort=top. Replies are fetched per comment from
+// /comments/:commentId/replies.
 func listRecipeComments(dbConn *db.Queries) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		recipeID, err := strconv.Atoi(c.Params("recipeId"))
@@ -272,11 +529,55 @@ func listRecipeComments(dbConn *db.Queries) fiber.Handler {
 			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
 		}
 
-		comments, err := dbConn.ListComments(c.Context(), pgtype.Int4{Int32: int32(recipeID), Valid: true})
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		sort := c.Query("sort", SORT_NEWEST)
+		if sort != SORT_NEWEST && sort != SORT_TOP {
+			return common.SendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("sort must be %s or %s", SORT_NEWEST, SORT_TOP))
+		}
+
+		userId, _ := c.Locals(logger.UserId).(int32)
+		params := db.ListCommentsParams{
+			ViewerID:  userId,
+			RecipeID:  pgtype.Int4{Int32: int32(recipeID), Valid: true},
+			Sort:      sort,
+			PageLimit: page.Fetch(),
+		}
+		if sort == SORT_NEWEST {
+			params.CursorCreatedAt, params.CursorID = page.After()
+		} else {
+			params.PageOffset = page.Offset()
+		}
+
+		comments, err := dbConn.ListComments(c.Context(), params)
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch comments")
 		}
-		return c.JSON(comments)
+
+		var rows pagination.Page[db.ListCommentsRow]
+		if sort == SORT_NEWEST {
+			rows = pagination.NewPage(page, comments, func(rc db.ListCommentsRow) (pgtype.Timestamp, int32) {
+				return rc.RecipeComment.CreatedAt, rc.RecipeComment.ID
+			})
+		} else {
+			rows = pagination.NewOffsetPage(page, comments)
+		}
+
+		items := make([]models.Comment, len(rows.Items))
+		for i, rc := range rows.Items {
+			items[i], err = models.FromComment(rc.RecipeComment, rc.User, rc.ReplyCount).WithReactions(rc.Reactions, rc.MyReaction)
+			if err != nil {
+				slog.ErrorContext(c.Context(), err.Error())
+				return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch comments")
+			}
+		}
+
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
 	}
 }
@@ -0,0 +1,96 @@
+package recipes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"ChaiwalaBackend/db"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeRow scans a fixed set of column values in order.
+type fakeRow []any
+
+func (r fakeRow) Scan(dest ...any) error {
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r[i]))
+	}
+	return nil
+}
+
+// fakeDB answers every QueryRow with the same row.
+type fakeDB struct{ row fakeRow }
+
+func (f fakeDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (f fakeDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, pgx.ErrNoRows
+}
+
+func (f fakeDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return f.row
+}
+
+func TestGetRecipeByIDKeepsStoredIngredients(t *testing.T) {
+	// amounts and units that converting would round and rename
+	ingredients := []byte(`[{"name":"Tea","quantity":333,"unit":"g"},{"name":"Sugar","quantity":1.3,"unit":"Tablespoons","note":"to taste"}]`)
+
+	row := fakeRow{
+		int32(1),                           // id
+		pgtype.Int4{Int32: 2, Valid: true}, // user_id
+		"Masala chai",                      // title
+		"",                                 // description
+		int32(TTChai),                      // type
+		"",                                 // asset_id
+		pgtype.Int4{},                      // prep_time_minutes
+		pgtype.Int4{Int32: 4, Valid: true}, // servings
+		pgtype.Bool{Bool: true, Valid: true},
+		pgtype.Timestamp{},
+		pgtype.Timestamp{},
+		int32(1), // version
+		int32(0), // comments_count
+		int32(0), // favorites_count
+		int32(0), // ratings_count
+		int32(0), // ratings_sum
+		[]byte(`{"id":2}`),
+		[]byte(`[]`),
+		ingredients,
+		false,
+		[]int32{0, 0, 0, 0, 0},
+		int32(0),
+	}
+
+	app := fiber.New()
+	app.Get("/recipes/:recipeId", getRecipeByID(db.New(fakeDB{row})))
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/recipes/1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status = %d, body %s", resp.StatusCode, body)
+	}
+
+	var detail struct {
+		Ingredients json.RawMessage `json:"ingredients"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(detail.Ingredients, ingredients) {
+		t.Errorf("ingredients = %s, want %s", detail.Ingredients, ingredients)
+	}
+}
@@ -0,0 +1,441 @@
+package recipes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"ChaiwalaBackend/db"
+	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/models"
+	common "ChaiwalaBackend/routes"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func buildStepsRouter(recipeRouter fiber.Router, pool *pgxpool.Pool, dbConn *db.Queries) {
+	recipeRouter.Get("/:recipeId/steps", listSteps(dbConn))
+	recipeRouter.Post("/:recipeId/steps", addStep(pool))
+	recipeRouter.Post("/:recipeId/steps/reorder", reorderSteps(pool))
+	recipeRouter.Put("/:recipeId/steps/:stepId", updateStep(pool))
+	recipeRouter.Delete("/:recipeId/steps/:stepId", deleteStep(pool))
+}
+
+// lockRecipeForEdit locks the recipe row for the rest of tx and checks the
+// caller owns it and, when sent, the If-Match precondition. A non zero status
+// means the request must be rejected with the returned message.
+func lockRecipeForEdit(c fiber.Ctx, q *db.Queries, recipeID int32) (int, string) {
+	recipe, err := q.GetRecipeForUpdate(c.Context(), recipeID)
+	if err != nil {
+		slog.ErrorContext(c.Context(), err.Error())
+		return http.StatusNotFound, "Recipe not found"
+	}
+
+	userId, _ := c.Locals(logger.UserId).(int32)
+	if recipe.UserID.Int32 != userId {
+		return http.StatusForbidden, "Only the author can edit this recipe"
+	}
+
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" && !ifMatchesVersion(ifMatch, recipe.Version) {
+		c.Set(fiber.HeaderETag, recipeETag(recipe.Version))
+		return http.StatusPreconditionFailed, "Recipe was modified by someone else, fetch it again before updating"
+	}
+
+	return 0, ""
+}
+
+func listSteps(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		recipeID, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+
+		steps, err := dbConn.GetRecipeStepsByRecipe(c.Context(), pgtype.Int4{Int32: int32(recipeID), Valid: true})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipe steps")
+		}
+
+		return c.JSON(models.FromSteps(steps))
+	}
+}
+
+// addStep inserts a step at stepNumber, shifting the following steps down,
+// or appends it when stepNumber is omitted or past the end.
+func addStep(pool *pgxpool.Pool) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		recipeID, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+
+		var s Step
+		if err := c.Bind().JSON(&s); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid input")
+		}
+		if s.Description == "" {
+			return common.SendErrorResponse(c, http.StatusUnprocessableEntity, "Step description is required")
+		}
+
+		tx, err := pool.Begin(c.Context())
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
+		}
+		defer common.Rollback(c.Context(), tx)
+
+		q := db.New(tx)
+		if status, msg := lockRecipeForEdit(c, q, int32(recipeID)); status != 0 {
+			return common.SendErrorResponse(c, status, msg)
+		}
+
+		recipe := pgtype.Int4{Int32: int32(recipeID), Valid: true}
+		last, err := q.GetLastRecipeStepNumber(c.Context(), recipe)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to add recipe step")
+		}
+
+		stepNumber := int32(s.StepNumber)
+		if stepNumber < 1 || stepNumber > last {
+			stepNumber = last + 1
+		} else {
+			err = q.ShiftRecipeSteps(c.Context(), db.ShiftRecipeStepsParams{
+				Delta:          1,
+				RecipeID:       recipe,
+				FromStepNumber: stepNumber,
+			})
+			if err != nil {
+				slog.ErrorContext(c.Context(), err.Error())
+				return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to add recipe step")
+			}
+		}
+
+		step, err := q.AddRecipeStep(c.Context(), db.AddRecipeStepParams{
+			RecipeID:    recipe,
+			StepNumber:  stepNumber,
+			Description: s.Description,
+			AssetID:     pgtype.Text{String: s.AssetId, Valid: s.AssetId != ""},
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to add recipe step")
+		}
+
+		version, err := q.TouchRecipe(c.Context(), int32(recipeID))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to add recipe step")
+		}
+
+		if err := tx.Commit(c.Context()); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction")
+		}
+
+		slog.InfoContext(c.Context(), "Recipe step added", slog.Int("stepId", int(step.ID)))
+		c.Set(fiber.HeaderETag, recipeETag(version))
+		return c.Status(http.StatusCreated).JSON(models.FromStep(step))
+	}
+}
+
+// updateStep changes the content of a step, use reorderSteps to move it.
+func updateStep(pool *pgxpool.Pool) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		recipeID, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+		stepID, err := strconv.Atoi(c.Params("stepId"))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid step ID")
+		}
+
+		var s Step
+		if err := c.Bind().JSON(&s); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid input")
+		}
+		if s.Description == "" {
+			return common.SendErrorResponse(c, http.StatusUnprocessableEntity, "Step description is required")
+		}
+
+		tx, err := pool.Begin(c.Context())
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
+		}
+		defer common.Rollback(c.Context(), tx)
+
+		q := db.New(tx)
+		if status, msg := lockRecipeForEdit(c, q, int32(recipeID)); status != 0 {
+			return common.SendErrorResponse(c, status, msg)
+		}
+
+		step, err := q.UpdateRecipeStepContent(c.Context(), db.UpdateRecipeStepContentParams{
+			ID:          int32(stepID),
+			RecipeID:    pgtype.Int4{Int32: int32(recipeID), Valid: true},
+			Description: s.Description,
+			AssetID:     pgtype.Text{String: s.AssetId, Valid: s.AssetId != ""},
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusNotFound, "Recipe step not found")
+		}
+
+		version, err := q.TouchRecipe(c.Context(), int32(recipeID))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to update recipe step")
+		}
+
+		if err := tx.Commit(c.Context()); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction")
+		}
+
+		c.Set(fiber.HeaderETag, recipeETag(version))
+		return c.JSON(models.FromStep(step))
+	}
+}
+
+// deleteStep removes a step and closes the gap it leaves in the numbering.
+func deleteStep(pool *pgxpool.Pool) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		recipeID, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+		stepID, err := strconv.Atoi(c.Params("stepId"))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid step ID")
+		}
+
+		tx, err := pool.Begin(c.Context())
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
+		}
+		defer common.Rollback(c.Context(), tx)
+
+		q := db.New(tx)
+		if status, msg := lockRecipeForEdit(c, q, int32(recipeID)); status != 0 {
+			return common.SendErrorResponse(c, status, msg)
+		}
+
+		step, err := q.GetRecipeStep(c.Context(), int32(stepID))
+		if err != nil || step.RecipeID.Int32 != int32(recipeID) {
+			return common.SendErrorResponse(c, http.StatusNotFound, "Recipe step not found")
+		}
+
+		if err := q.DeleteRecipeStep(c.Context(), step.ID); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to delete recipe step")
+		}
+		err = q.ShiftRecipeSteps(c.Context(), db.ShiftRecipeStepsParams{
+			Delta:          -1,
+			RecipeID:       step.RecipeID,
+			FromStepNumber: step.StepNumber + 1,
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to delete recipe step")
+		}
+
+		version, err := q.TouchRecipe(c.Context(), int32(recipeID))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to delete recipe step")
+		}
+
+		if err := tx.Commit(c.Context()); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction")
+		}
+
+		slog.InfoContext(c.Context(), "Recipe step deleted", slog.Int("stepId", stepID))
+		c.Set(fiber.HeaderETag, recipeETag(version))
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// reorderSteps renumbers all steps of a recipe in the order of the given ids,
+// which must list every step exactly once.
+func reorderSteps(pool *pgxpool.Pool) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		recipeID, err := strconv.Atoi(c.Params("recipeId"))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid recipe ID")
+		}
+
+		var r ReorderStepsBody
+		if err := c.Bind().JSON(&r); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid input")
+		}
+
+		tx, err := pool.Begin(c.Context())
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Sorry, something went wrong. Please try again later.")
+		}
+		defer common.Rollback(c.Context(), tx)
+
+		q := db.New(tx)
+		if status, msg := lockRecipeForEdit(c, q, int32(recipeID)); status != 0 {
+			return common.SendErrorResponse(c, status, msg)
+		}
+
+		recipe := pgtype.Int4{Int32: int32(recipeID), Valid: true}
+		steps, err := q.GetRecipeStepsByRecipe(c.Context(), recipe)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipe steps")
+		}
+
+		if !samePermutation(steps, r.StepIds) {
+			return common.SendErrorResponse(c, http.StatusUnprocessableEntity, "stepIds must list every step of the recipe exactly once")
+		}
+
+		err = q.RenumberRecipeSteps(c.Context(), db.RenumberRecipeStepsParams{
+			RecipeID: recipe,
+			StepIds:  r.StepIds,
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to reorder recipe steps")
+		}
+
+		version, err := q.TouchRecipe(c.Context(), int32(recipeID))
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to reorder recipe steps")
+		}
+
+		steps, err = q.GetRecipeStepsByRecipe(c.Context(), recipe)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch recipe steps")
+		}
+
+		if err := tx.Commit(c.Context()); err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction")
+		}
+
+		c.Set(fiber.HeaderETag, recipeETag(version))
+		return c.JSON(models.FromSteps(steps))
+	}
+}
+
+func samePermutation(steps []db.RecipeStep, ids []int32) bool {
+	if len(steps) != len(ids) {
+		return false
+	}
+
+	seen := make(map[int32]bool, len(steps))
+	for _, s := range steps {
+		seen[s.ID] = false
+	}
+	for _, id := range ids {
+		used, ok := seen[id]
+		if !ok || used {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+var errInvalidSteps = errors.New("invalid steps")
+
+// syncSteps makes the steps of a recipe match want, numbered by their
+// position. Steps with an id are updated when changed, steps without one are
+// inserted and existing steps missing from want are deleted. It relies on the
+// deferred step number constraint, so q must run in a transaction.
+func syncSteps(ctx context.Context, q *db.Queries, recipeID int32, want []SavedStep) error {
+	recipe := pgtype.Int4{Int32: recipeID, Valid: true}
+	existing, err := q.GetRecipeStepsByRecipe(ctx, recipe)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[int32]db.RecipeStep, len(existing))
+	for _, s := range existing {
+		current[s.ID] = s
+	}
+
+	kept := make(map[int32]bool, len(want))
+	for i, s := range want {
+		if s.Description == "" {
+			return fmt.Errorf("%w: step %d has no description", errInvalidSteps, i+1)
+		}
+		if s.ID == 0 {
+			continue
+		}
+		if _, ok := current[int32(s.ID)]; !ok {
+			return fmt.Errorf("%w: step %d does not belong to this recipe", errInvalidSteps, s.ID)
+		}
+		if kept[int32(s.ID)] {
+			return fmt.Errorf("%w: step %d is listed more than once", errInvalidSteps, s.ID)
+		}
+		kept[int32(s.ID)] = true
+	}
+
+	for _, s := range existing {
+		if kept[s.ID] {
+			continue
+		}
+		if err := q.DeleteRecipeStep(ctx, s.ID); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range want {
+		stepNumber := int32(i + 1)
+		assetID := pgtype.Text{String: s.AssetId, Valid: s.AssetId != ""}
+
+		if s.ID == 0 {
+			_, err := q.AddRecipeStep(ctx, db.AddRecipeStepParams{
+				RecipeID:    recipe,
+				StepNumber:  stepNumber,
+				Description: s.Description,
+				AssetID:     assetID,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		old := current[int32(s.ID)]
+		if old.StepNumber == stepNumber && old.Description == s.Description && old.AssetID == assetID {
+			continue
+		}
+		err := q.UpdateRecipeStep(ctx, db.UpdateRecipeStepParams{
+			ID:          old.ID,
+			StepNumber:  stepNumber,
+			Description: s.Description,
+			AssetID:     assetID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
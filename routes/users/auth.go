@@ -7,6 +7,8 @@ import (
 
 	"ChaiwalaBackend/clients/jwt"
 	"ChaiwalaBackend/db"
+	"ChaiwalaBackend/metrics"
+	"ChaiwalaBackend/models"
 	common "ChaiwalaBackend/routes"
 
 	"github.com/gofiber/fiber/v3"
@@ -15,18 +17,18 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func BuildAuthRouter(app *fiber.App, dbConn *db.Queries) *fiber.Router {
+func BuildAuthRouter(app *fiber.App, dbConn *db.Queries, jwtClient jwt.JWTClient) *fiber.Router {
 	userRouter := app.Group("/auth")
 
 	userRouter.Get("", getUser(dbConn))
-	userRouter.Post("/register", registerUser(dbConn))
-	userRouter.Post("/login", loginUser(dbConn))
-	userRouter.Post("/refresh", refreshRoute(dbConn))
+	userRouter.Post("/register", registerUser(dbConn, jwtClient))
+	userRouter.Post("/login", loginUser(dbConn, jwtClient))
+	userRouter.Post("/refresh", refreshRoute(jwtClient))
 
 	return &userRouter
 }
 
-func registerUser(dbConn *db.Queries) fiber.Handler {
+func registerUser(dbConn *db.Queries, jwtClient jwt.JWTClient) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		u := new(RegisterUser)
 		if err := c.Bind().JSON(u); err != nil {
@@ -52,7 +54,7 @@ func registerUser(dbConn *db.Queries) fiber.Handler {
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "User could not be created")
 		}
 
-		at, rt, exp, err := jwt.GenerateTokens(usr.Email, usr.ID)
+		at, rt, exp, err := jwtClient.GenerateTokens(usr.Email, usr.ID)
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not generate JWT")
@@ -67,7 +69,7 @@ func registerUser(dbConn *db.Queries) fiber.Handler {
 	}
 }
 
-func loginUser(dbConn *db.Queries) fiber.Handler {
+func loginUser(dbConn *db.Queries, jwtClient jwt.JWTClient) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		slog.InfoContext(c.Context(), "Received a request to loginUser")
 		u := new(LoginUser)
@@ -77,16 +79,18 @@ func loginUser(dbConn *db.Queries) fiber.Handler {
 		usr, err := dbConn.GetUserByEmail(c.Context(), u.Email)
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
+			metrics.LoginsFailed.WithLabelValues("user_not_found").Inc()
 			return common.SendErrorResponse(c, http.StatusNotFound, "User not found")
 		}
 
 		err = bcrypt.CompareHashAndPassword([]byte(usr.PasswordHash), []byte(u.Password))
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
+			metrics.LoginsFailed.WithLabelValues("incorrect_password").Inc()
 			return common.SendErrorResponse(c, http.StatusUnauthorized, "Incorrect password")
 		}
 
-		at, rt, exp, err := jwt.GenerateTokens(usr.Email, usr.ID)
+		at, rt, exp, err := jwtClient.GenerateTokens(usr.Email, usr.ID)
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not generate a JWT")
@@ -100,18 +104,18 @@ func loginUser(dbConn *db.Queries) fiber.Handler {
 					ExpiresIn:    exp.UnixMilli(),
 					TokenType:    "Bearer",
 				},
-				User: usr,
+				User: models.FromUser(usr),
 			},
 		)
 	}
 }
 
-func refreshRoute(dbConn *db.Queries) fiber.Handler {
+func refreshRoute(jwtClient jwt.JWTClient) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		claims := c.Locals("claims").(jwt.Claims)
 
 		// todo(nick): need to revoke previous Refresh
-		newAccess, newRefresh, exp, err := jwt.GenerateTokens(claims.Email, claims.UserID)
+		newAccess, newRefresh, exp, err := jwtClient.GenerateTokens(claims.Email, claims.UserID)
 		if err != nil {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not generate JWT")
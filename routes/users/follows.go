@@ -0,0 +1,144 @@
+package users
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"ChaiwalaBackend/db"
+	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/models"
+	"ChaiwalaBackend/pagination"
+	common "ChaiwalaBackend/routes"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func followUser(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		followeeID, err := strconv.Atoi(c.Params("userId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		userId := c.Locals(logger.UserId).(int32)
+		if int32(followeeID) == userId {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "You cannot follow yourself")
+		}
+
+		err = dbConn.FollowUser(c.Context(), db.FollowUserParams{
+			FollowerID: userId,
+			FolloweeID: int32(followeeID),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			var e *pgconn.PgError
+			if errors.As(err, &e) && e.Code == pgerrcode.ForeignKeyViolation {
+				return common.SendErrorResponse(c, http.StatusNotFound, "User not found")
+			}
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not follow the user")
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+func unfollowUser(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		followeeID, err := strconv.Atoi(c.Params("userId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		err = dbConn.UnfollowUser(c.Context(), db.UnfollowUserParams{
+			FollowerID: c.Locals(logger.UserId).(int32),
+			FolloweeID: int32(followeeID),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not unfollow the user")
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+func listFollowers(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("userId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		cursorCreatedAt, cursorID := page.After()
+		followers, err := dbConn.ListFollowers(c.Context(), db.ListFollowersParams{
+			UserID:          int32(userID),
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.Fetch(),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch followers")
+		}
+
+		rows := pagination.NewPage(page, followers, func(f db.ListFollowersRow) (pgtype.Timestamp, int32) {
+			return f.FollowedAt, f.User.ID
+		})
+		items := make([]Follow, len(rows.Items))
+		for i, f := range rows.Items {
+			items[i] = Follow{User: models.FromUser(f.User), FollowedAt: f.FollowedAt.Time}
+		}
+
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
+	}
+}
+
+func listFollowing(dbConn *db.Queries) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("userId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		cursorCreatedAt, cursorID := page.After()
+		following, err := dbConn.ListFollowing(c.Context(), db.ListFollowingParams{
+			UserID:          int32(userID),
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.Fetch(),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch followed users")
+		}
+
+		rows := pagination.NewPage(page, following, func(f db.ListFollowingRow) (pgtype.Timestamp, int32) {
+			return f.FollowedAt, f.User.ID
+		})
+		items := make([]Follow, len(rows.Items))
+		for i, f := range rows.Items {
+			items[i] = Follow{User: models.FromUser(f.User), FollowedAt: f.FollowedAt.Time}
+		}
+
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
+	}
+}
@@ -1,6 +1,10 @@
 package users
 
-import "ChaiwalaBackend/db"
+import (
+	"time"
+
+	"ChaiwalaBackend/models"
+)
 
 type RegisterUser struct {
 	Email    string `json:"email"`
@@ -21,9 +25,21 @@ type GeneratedJWTResponse struct {
 
 type LoginUserResponse struct {
 	Token GeneratedJWTResponse `json:"token"`
-	User  db.User              `json:"user"`
+	User  models.User          `json:"user"`
 }
 
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refreshToken"`
 }
+
+// FavoriteRecipe is a recipe in a user's favorites, FavoritedByMe is about
+// the requesting user.
+type FavoriteRecipe struct {
+	models.RecipeSummary
+	FavoritedAt time.Time `json:"favoritedAt"`
+}
+
+type Follow struct {
+	User       models.User `json:"user"`
+	FollowedAt time.Time   `json:"followedAt"`
+}
@@ -6,6 +6,9 @@ import (
 	"strconv"
 
 	"ChaiwalaBackend/db"
+	logger "ChaiwalaBackend/logging"
+	"ChaiwalaBackend/models"
+	"ChaiwalaBackend/pagination"
 	common "ChaiwalaBackend/routes"
 
 	"github.com/gofiber/fiber/v3"
@@ -19,6 +22,10 @@ func BuildRouter(app *fiber.App, dbConn *db.Queries) *fiber.Router {
 	userRouter.Get("/:userId/recipes", listUserRecipes(dbConn))
 	userRouter.Get("/:userId/favorites", listUserFavorites(dbConn))
 	userRouter.Get("/:userId/comments", listUserComments(dbConn))
+	userRouter.Get("/:userId/followers", listFollowers(dbConn))
+	userRouter.Get("/:userId/following", listFollowing(dbConn))
+	userRouter.Post("/:userId/follow", followUser(dbConn))
+	userRouter.Delete("/:userId/follow", unfollowUser(dbConn))
 
 	return &userRouter
 }
@@ -30,7 +37,7 @@ func getUser(dbConn *db.Queries) fiber.Handler {
 			slog.ErrorContext(c.Context(), err.Error())
 			return common.SendErrorResponse(c, http.StatusNotFound, "User not found")
 		}
-		return c.JSON(usr)
+		return c.JSON(models.FromUser(usr))
 	}
 }
 
@@ -43,22 +50,66 @@ func listUserRecipes(dbConn *db.Queries) fiber.Handler {
 				RequestId: c.GetRespHeader("X-Request-ID"),
 			})
 		}
-		recipes, err := dbConn.ListUserRecipes(c.Context(), pgtype.Int4{Int32: int32(userID), Valid: true})
+		page, err := pagination.Parse(c)
 		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		viewerId, _ := c.Locals(logger.UserId).(int32)
+		cursorCreatedAt, cursorID := page.After()
+		recipes, err := dbConn.ListUserRecipes(c.Context(), db.ListUserRecipesParams{
+			UserID:          pgtype.Int4{Int32: int32(userID), Valid: true},
+			ViewerID:        viewerId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.Fetch(),
+		})
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
 			return c.Status(http.StatusInternalServerError).JSON(common.Error{
 				Message:   "Failed to fetch user recipes",
 				RequestId: c.GetRespHeader("X-Request-ID"),
 			})
 		}
-		return c.JSON(recipes)
+
+		rows := pagination.NewPage(page, recipes, func(r db.Recipe) (pgtype.Timestamp, int32) {
+			return r.CreatedAt, r.ID
+		})
+		summaries, err := common.SummarizeRecipes(c.Context(), dbConn, viewerId, rows.Items)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch user recipes")
+		}
+
+		result := pagination.WithItems(rows, summaries)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
 	}
 }
 
 func listUserFavorites(dbConn *db.Queries) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		userID := c.Locals("userId").(int32) // Assuming user ID is available in Locals
-		favorites, err := dbConn.ListUserFavorites(c.Context(), userID)
+		userID, err := strconv.Atoi(c.Params("userId"))
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		}
+
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		viewerId, _ := c.Locals(logger.UserId).(int32)
+		cursorCreatedAt, cursorID := page.After()
+		favorites, err := dbConn.ListUserFavorites(c.Context(), db.ListUserFavoritesParams{
+			UserID:          int32(userID),
+			ViewerID:        viewerId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.Fetch(),
+		})
 		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
 			c.Status(500)
 			return c.JSON(common.Error{
 				Message:   "Could not retrieve favorites",
@@ -66,7 +117,35 @@ func listUserFavorites(dbConn *db.Queries) fiber.Handler {
 			})
 		}
 
-		return c.Status(200).JSON(favorites)
+		// favorites are ordered by when they were added, not by recipe age
+		rows := pagination.NewPage(page, favorites, func(f db.ListUserFavoritesRow) (pgtype.Timestamp, int32) {
+			return f.FavoritedAt, f.Recipe.ID
+		})
+
+		ids := make([]int32, len(rows.Items))
+		for i, f := range rows.Items {
+			ids[i] = f.Recipe.ID
+		}
+		favoritedByMe, err := common.FavoritedRecipes(c.Context(), dbConn, viewerId, ids)
+		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
+			return common.SendErrorResponse(c, http.StatusInternalServerError, "Could not retrieve favorites")
+		}
+
+		items := make([]FavoriteRecipe, len(rows.Items))
+		for i, f := range rows.Items {
+			items[i] = FavoriteRecipe{
+				RecipeSummary: models.RecipeSummary{
+					Recipe:        models.FromRecipe(f.Recipe),
+					FavoritedByMe: favoritedByMe[f.Recipe.ID],
+				},
+				FavoritedAt: f.FavoritedAt.Time,
+			}
+		}
+
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.Status(200).JSON(result)
 	}
 }
 
@@ -80,13 +159,42 @@ func listUserComments(dbConn *db.Queries) fiber.Handler {
 			})
 		}
 
-		comments, err := dbConn.ListCommentsByUser(c.Context(), pgtype.Int4{Int32: int32(userID), Valid: true})
+		page, err := pagination.Parse(c)
+		if err != nil {
+			return common.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+		}
+
+		cursorCreatedAt, cursorID := page.After()
+		viewerId, _ := c.Locals(logger.UserId).(int32)
+		comments, err := dbConn.ListCommentsByUser(c.Context(), db.ListCommentsByUserParams{
+			ViewerID:        viewerId,
+			UserID:          pgtype.Int4{Int32: int32(userID), Valid: true},
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       page.Fetch(),
+		})
 		if err != nil {
+			slog.ErrorContext(c.Context(), err.Error())
 			return c.Status(http.StatusInternalServerError).JSON(common.Error{
 				Message:   "Failed to fetch user comments",
 				RequestId: c.GetRespHeader("X-Request-ID"),
 			})
 		}
-		return c.JSON(comments)
+
+		rows := pagination.NewPage(page, comments, func(rc db.ListCommentsByUserRow) (pgtype.Timestamp, int32) {
+			return rc.RecipeComment.CreatedAt, rc.RecipeComment.ID
+		})
+		items := make([]models.Comment, len(rows.Items))
+		for i, rc := range rows.Items {
+			items[i], err = models.FromComment(rc.RecipeComment, rc.User, rc.ReplyCount).WithReactions(rc.Reactions, rc.MyReaction)
+			if err != nil {
+				slog.ErrorContext(c.Context(), err.Error())
+				return common.SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch user comments")
+			}
+		}
+
+		result := pagination.WithItems(rows, items)
+		pagination.SetLinkHeader(c, result.NextCursor)
+		return c.JSON(result)
 	}
 }
@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Every runs job every interval in the background until ctx is done. A
+// failing run is logged and retried on the next tick.
+func Every(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run(ctx, name, job)
+			}
+		}
+	}()
+}
+
+// EveryFromNow is like Every but also runs job right away, for jobs whose
+// results are needed before the first tick.
+func EveryFromNow(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	go func() {
+		run(ctx, name, job)
+		Every(ctx, name, interval, job)
+	}()
+}
+
+func run(ctx context.Context, name string, job func(context.Context) error) {
+	start := time.Now()
+	if err := job(ctx); err != nil {
+		slog.ErrorContext(ctx, "scheduled job failed", slog.String("job", name), slog.String("error", err.Error()))
+		return
+	}
+	slog.DebugContext(ctx, "scheduled job finished", slog.String("job", name), slog.String("duration", time.Since(start).String()))
+}
@@ -18,7 +18,15 @@ CREATE TABLE recipes (
     servings INTEGER,
     is_public BOOLEAN DEFAULT TRUE,
     created_at TIMESTAMP DEFAULT NOW (),
-    updated_at TIMESTAMP DEFAULT NOW ()
+    updated_at TIMESTAMP DEFAULT NOW (),
+    -- bumped on every change, exposed as the recipe ETag
+    version INTEGER NOT NULL DEFAULT 1,
+    -- maintained by triggers on recipe_comments, favorites and ratings, they
+    -- do not bump version
+    comments_count INTEGER NOT NULL DEFAULT 0,
+    favorites_count INTEGER NOT NULL DEFAULT 0,
+    ratings_count INTEGER NOT NULL DEFAULT 0,
+    ratings_sum INTEGER NOT NULL DEFAULT 0
 );
 
 CREATE TABLE recipe_steps (
@@ -26,7 +34,28 @@ CREATE TABLE recipe_steps (
     recipe_id INTEGER REFERENCES recipes (id) ON DELETE CASCADE,
     step_number INTEGER NOT NULL,
     description TEXT NOT NULL,
-    asset_id TEXT
+    asset_id TEXT,
+    -- deferred so steps can be renumbered within a transaction
+    CONSTRAINT recipe_steps_recipe_id_step_number_key UNIQUE (recipe_id, step_number)
+        DEFERRABLE INITIALLY DEFERRED
+);
+
+-- Canonical ingredient names, shared by all recipes so they can be searched.
+CREATE TABLE ingredients (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL
+);
+
+CREATE TABLE recipe_ingredients (
+    id SERIAL PRIMARY KEY,
+    recipe_id INTEGER NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+    ingredient_id INTEGER NOT NULL REFERENCES ingredients (id),
+    position INTEGER NOT NULL,
+    quantity DOUBLE PRECISION,
+    unit VARCHAR(20),
+    note TEXT,
+    CONSTRAINT recipe_ingredients_recipe_id_position_key UNIQUE (recipe_id, position)
+        DEFERRABLE INITIALLY DEFERRED
 );
 
 CREATE TABLE recipe_comments (
@@ -34,7 +63,26 @@ CREATE TABLE recipe_comments (
     recipe_id INTEGER REFERENCES recipes (id) ON DELETE CASCADE,
     user_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
     comment TEXT NOT NULL,
-    created_at TIMESTAMP DEFAULT NOW ()
+    created_at TIMESTAMP DEFAULT NOW (),
+    -- replies point at the comment they answer, top level comments have depth 0.
+    -- Deleting a comment with replies must tombstone it, never the thread.
+    parent_id INTEGER REFERENCES recipe_comments (id) ON DELETE RESTRICT,
+    depth INTEGER NOT NULL DEFAULT 0 CHECK (depth >= 0),
+    -- deleting a comment with replies only tombstones it so the thread stays
+    -- readable, its text is cleared
+    deleted_at TIMESTAMP,
+    -- maintained by a trigger on comment_reactions
+    reactions_count INTEGER NOT NULL DEFAULT 0
+);
+
+-- One reaction per user and comment, reaction is one of the names the server
+-- allows, e.g. like or love.
+CREATE TABLE comment_reactions (
+    comment_id INTEGER NOT NULL REFERENCES recipe_comments (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    reaction VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (comment_id, user_id)
 );
 
 -- Favorites (likes/bookmarks)
@@ -45,11 +93,201 @@ CREATE TABLE favorites (
     PRIMARY KEY (user_id, recipe_id)
 );
 
+-- Star ratings, one per user and recipe, optionally with a written review.
+CREATE TABLE ratings (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    recipe_id INTEGER NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+    stars INTEGER NOT NULL CHECK (stars BETWEEN 1 AND 5),
+    review TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW (),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (user_id, recipe_id)
+);
+
+CREATE TABLE follows (
+    follower_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    followee_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+-- Recipe rankings per trending window, rebuilt periodically by the server.
+CREATE TABLE trending_recipes (
+    window_name VARCHAR(20) NOT NULL,
+    recipe_id INTEGER NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+    tea_type INTEGER NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMP NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (window_name, recipe_id)
+);
+
+-- Responses to POST requests sent with an Idempotency-Key, replayed on retries.
+-- status_code is NULL while the original request is still being handled.
+CREATE TABLE idempotency_keys (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER,
+    content_type TEXT,
+    response_body BYTEA,
+    created_at TIMESTAMP DEFAULT NOW (),
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+-- Full text search document per recipe. It spans steps and ingredients, which
+-- a generated column cannot reference, so triggers keep it up to date.
+CREATE TABLE recipe_search (
+    recipe_id INTEGER PRIMARY KEY REFERENCES recipes (id) ON DELETE CASCADE,
+    document TSVECTOR NOT NULL
+);
+
+CREATE FUNCTION recipe_search_document (r_id INTEGER, r_title TEXT, r_description TEXT)
+RETURNS TSVECTOR AS $$
+    SELECT
+        setweight(to_tsvector('english', coalesce(r_title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce((
+            SELECT string_agg(i.name, ' ')
+            FROM recipe_ingredients ri
+            JOIN ingredients i ON ri.ingredient_id = i.id
+            WHERE ri.recipe_id = r_id
+        ), '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(r_description, '')), 'C') ||
+        setweight(to_tsvector('english', coalesce((
+            SELECT string_agg(description, ' ')
+            FROM recipe_steps
+            WHERE recipe_id = r_id
+        ), '')), 'D')
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION refresh_recipe_search (r_id INTEGER) RETURNS VOID AS $$
+    INSERT INTO recipe_search (recipe_id, document)
+    SELECT id, recipe_search_document(id, title, description)
+    FROM recipes
+    WHERE id = r_id
+    ON CONFLICT (recipe_id) DO UPDATE SET document = EXCLUDED.document;
+$$ LANGUAGE sql;
+
+CREATE FUNCTION recipes_search_trigger () RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_recipe_search(NEW.id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION recipe_children_search_trigger () RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM refresh_recipe_search(OLD.recipe_id);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM refresh_recipe_search(NEW.recipe_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER recipes_search
+AFTER INSERT OR UPDATE OF title, description ON recipes
+FOR EACH ROW EXECUTE FUNCTION recipes_search_trigger();
+
+CREATE TRIGGER recipe_steps_search
+AFTER INSERT OR UPDATE OR DELETE ON recipe_steps
+FOR EACH ROW EXECUTE FUNCTION recipe_children_search_trigger();
+
+CREATE TRIGGER recipe_ingredients_search
+AFTER INSERT OR UPDATE OR DELETE ON recipe_ingredients
+FOR EACH ROW EXECUTE FUNCTION recipe_children_search_trigger();
+
+-- Tombstoned comments are not counted.
+CREATE FUNCTION recipe_comments_count_trigger () RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE recipes SET comments_count = comments_count + 1 WHERE id = NEW.recipe_id;
+    ELSIF OLD.deleted_at IS NULL AND (TG_OP = 'DELETE' OR NEW.deleted_at IS NOT NULL) THEN
+        UPDATE recipes SET comments_count = comments_count - 1 WHERE id = OLD.recipe_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION favorites_count_trigger () RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE recipes SET favorites_count = favorites_count + 1 WHERE id = NEW.recipe_id;
+    ELSE
+        UPDATE recipes SET favorites_count = favorites_count - 1 WHERE id = OLD.recipe_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION ratings_count_trigger () RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        UPDATE recipes SET ratings_count = ratings_count - 1, ratings_sum = ratings_sum - OLD.stars
+        WHERE id = OLD.recipe_id;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        UPDATE recipes SET ratings_count = ratings_count + 1, ratings_sum = ratings_sum + NEW.stars
+        WHERE id = NEW.recipe_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION comment_reactions_count_trigger () RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE recipe_comments SET reactions_count = reactions_count + 1 WHERE id = NEW.comment_id;
+    ELSE
+        UPDATE recipe_comments SET reactions_count = reactions_count - 1 WHERE id = OLD.comment_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER recipe_comments_count
+AFTER INSERT OR UPDATE OF deleted_at OR DELETE ON recipe_comments
+FOR EACH ROW EXECUTE FUNCTION recipe_comments_count_trigger();
+
+CREATE TRIGGER favorites_count
+AFTER INSERT OR DELETE ON favorites
+FOR EACH ROW EXECUTE FUNCTION favorites_count_trigger();
+
+CREATE TRIGGER comment_reactions_count
+AFTER INSERT OR DELETE ON comment_reactions
+FOR EACH ROW EXECUTE FUNCTION comment_reactions_count_trigger();
+
+CREATE TRIGGER ratings_count
+AFTER INSERT OR UPDATE OF stars OR DELETE ON ratings
+FOR EACH ROW EXECUTE FUNCTION ratings_count_trigger();
+
 -- Indexes for performance
 CREATE INDEX idx_recipes_user_id ON recipes (user_id);
 
+-- the feed reads the latest recipes of each followed user
+CREATE INDEX idx_recipes_user_id_created_at ON recipes (user_id, created_at DESC, id DESC);
+
+CREATE INDEX idx_follows_follower_id_created_at ON follows (follower_id, created_at DESC);
+
+CREATE INDEX idx_follows_followee_id_created_at ON follows (followee_id, created_at DESC);
+
 CREATE INDEX idx_favorites_user_id ON favorites (user_id);
 
+CREATE INDEX idx_ratings_recipe_id_updated_at ON ratings (recipe_id, updated_at DESC);
+
 CREATE INDEX idx_recipe_comments_recipe_id ON recipe_comments (recipe_id);
 
+CREATE INDEX idx_recipe_comments_parent_id_created_at ON recipe_comments (parent_id, created_at);
+
 CREATE INDEX idx_recipe_steps_recipe_id ON recipe_steps (recipe_id);
+
+CREATE INDEX idx_recipe_ingredients_ingredient_id ON recipe_ingredients (ingredient_id);
+
+CREATE INDEX idx_recipe_search_document ON recipe_search USING GIN (document);
+
+CREATE INDEX idx_trending_recipes_window_name_score ON trending_recipes (window_name, score DESC);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,121 @@
+// Package trending precomputes time decayed recipe rankings so serving them is
+// a plain table read.
+package trending
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ChaiwalaBackend/db"
+	common "ChaiwalaBackend/routes"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MAX_PER_TEA_TYPE is how many recipes of each tea type are ranked per window.
+const MAX_PER_TEA_TYPE = 100
+
+var ErrInvalidWindows = errors.New("trending windows must look like 24h,7d")
+
+// Window is a period over which favorites and comments count towards a
+// recipe's score, written like 24h or 7d.
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Windows are the configured trending windows, the first one is the default.
+type Windows []Window
+
+// UnmarshalText parses comma separated windows like "24h,7d,30d".
+func (w *Windows) UnmarshalText(text []byte) error {
+	var out Windows
+	for _, name := range strings.Split(string(text), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		d, err := parseWindow(name)
+		if err != nil || d <= 0 {
+			return ErrInvalidWindows
+		}
+		out = append(out, Window{Name: name, Duration: d})
+	}
+	if len(out) == 0 {
+		return ErrInvalidWindows
+	}
+
+	*w = out
+	return nil
+}
+
+func parseWindow(name string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(name, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(name)
+}
+
+func (w Windows) String() string {
+	names := make([]string, len(w))
+	for i, window := range w {
+		names[i] = window.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// Find returns the window called name, or the default one for "".
+func (w Windows) Find(name string) (Window, bool) {
+	if name == "" && len(w) > 0 {
+		return w[0], true
+	}
+	for _, window := range w {
+		if window.Name == name {
+			return window, true
+		}
+	}
+	return Window{}, false
+}
+
+// Refresh recomputes the rankings of every window. A recipe scores
+// (2 * favorites + comments) / (age in hours + 2)^gravity, counting only
+// favorites and comments made within the window.
+func Refresh(ctx context.Context, pool *pgxpool.Pool, windows Windows, gravity float64) error {
+	for _, w := range windows {
+		if err := refreshWindow(ctx, pool, w, gravity); err != nil {
+			return fmt.Errorf("refreshing trending window %s: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+func refreshWindow(ctx context.Context, pool *pgxpool.Pool, w Window, gravity float64) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer common.Rollback(ctx, tx)
+
+	q := db.New(tx)
+	if err := q.ClearTrendingRecipes(ctx, w.Name); err != nil {
+		return err
+	}
+
+	_, err = q.RankTrendingRecipes(ctx, db.RankTrendingRecipesParams{
+		WindowName:    w.Name,
+		WindowSeconds: w.Duration.Seconds(),
+		Gravity:       gravity,
+		MaxPerTeaType: MAX_PER_TEA_TYPE,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
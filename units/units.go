@@ -0,0 +1,160 @@
+// Package units scales ingredient quantities and converts them between
+// metric and imperial kitchen units.
+package units
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+var ErrInvalidSystem = errors.New("units must be metric or imperial")
+
+type System string
+
+const (
+	// ORIGINAL keeps quantities in the unit they were entered in.
+	ORIGINAL System = ""
+	METRIC   System = "metric"
+	IMPERIAL System = "imperial"
+)
+
+func ParseSystem(s string) (System, error) {
+	switch System(strings.ToLower(strings.TrimSpace(s))) {
+	case ORIGINAL:
+		return ORIGINAL, nil
+	case METRIC:
+		return METRIC, nil
+	case IMPERIAL:
+		return IMPERIAL, nil
+	}
+	return ORIGINAL, ErrInvalidSystem
+}
+
+type dimension int
+
+const (
+	volume dimension = iota
+	mass
+)
+
+type unit struct {
+	name string
+	dim  dimension
+	// base is the size of the unit in ml for volumes and g for masses.
+	base float64
+}
+
+var (
+	milliliter = unit{"ml", volume, 1}
+	liter      = unit{"l", volume, 1000}
+	teaspoon   = unit{"tsp", volume, 4.92892}
+	tablespoon = unit{"tbsp", volume, 14.7868}
+	fluidOunce = unit{"fl oz", volume, 29.5735}
+	cup        = unit{"cup", volume, 236.588}
+	gram       = unit{"g", mass, 1}
+	kilogram   = unit{"kg", mass, 1000}
+	ounce      = unit{"oz", mass, 28.3495}
+	pound      = unit{"lb", mass, 453.592}
+)
+
+var aliases = map[string]unit{
+	"ml": milliliter, "milliliter": milliliter, "milliliters": milliliter, "millilitre": milliliter, "millilitres": milliliter,
+	"l": liter, "liter": liter, "liters": liter, "litre": liter, "litres": liter,
+	"tsp": teaspoon, "teaspoon": teaspoon, "teaspoons": teaspoon,
+	"tbsp": tablespoon, "tablespoon": tablespoon, "tablespoons": tablespoon,
+	"fl oz": fluidOunce, "floz": fluidOunce, "fluid ounce": fluidOunce, "fluid ounces": fluidOunce,
+	"cup": cup, "cups": cup,
+	"g": gram, "gram": gram, "grams": gram,
+	"kg": kilogram, "kilogram": kilogram, "kilograms": kilogram,
+	"oz": ounce, "ounce": ounce, "ounces": ounce,
+	"lb": pound, "lbs": pound, "pound": pound, "pounds": pound,
+}
+
+func lookup(name string) (unit, bool) {
+	u, ok := aliases[strings.ToLower(strings.Join(strings.Fields(name), " "))]
+	return u, ok
+}
+
+// Quantity is an amount of Unit. Units this package does not know, like
+// "pinch" or "bag", are scaled but never converted.
+type Quantity struct {
+	Amount float64
+	Unit   string
+}
+
+// Scale multiplies q by factor, e.g. servings wanted over recipe servings.
+func Scale(q Quantity, factor float64) Quantity {
+	return Quantity{Amount: q.Amount * factor, Unit: q.Unit}
+}
+
+// Convert expresses q in the most readable unit of system and rounds it.
+func Convert(q Quantity, system System) Quantity {
+	from, ok := lookup(q.Unit)
+	if !ok {
+		return Quantity{Amount: roundPlain(q.Amount), Unit: q.Unit}
+	}
+	if system == ORIGINAL {
+		return Quantity{Amount: round(q.Amount, from), Unit: from.name}
+	}
+
+	amount := q.Amount * from.base
+	to := pick(amount, from.dim, system)
+	return Quantity{Amount: round(amount/to.base, to), Unit: to.name}
+}
+
+// pick chooses the unit for an amount given in ml or g.
+func pick(amount float64, dim dimension, system System) unit {
+	switch {
+	case dim == volume && system == METRIC:
+		if amount >= liter.base {
+			return liter
+		}
+		return milliliter
+	case dim == volume:
+		switch {
+		case amount < tablespoon.base:
+			return teaspoon
+		case amount < cup.base/4:
+			return tablespoon
+		}
+		return cup
+	case system == METRIC:
+		if amount >= kilogram.base {
+			return kilogram
+		}
+		return gram
+	}
+
+	if amount >= pound.base {
+		return pound
+	}
+	return ounce
+}
+
+// round keeps spoons and cups to kitchen fractions and everything else to a
+// precision that matches its size.
+func round(amount float64, u unit) float64 {
+	switch u {
+	case teaspoon, tablespoon, cup:
+		if amount > 0 && amount < 0.125 {
+			return 0.125
+		}
+		return math.Round(amount*8) / 8
+	case liter, kilogram, pound:
+		return math.Round(amount*100) / 100
+	}
+	return roundPlain(amount)
+}
+
+func roundPlain(amount float64) float64 {
+	switch {
+	case amount < 1:
+		return math.Round(amount*100) / 100
+	case amount < 10:
+		return math.Round(amount*10) / 10
+	case amount < 100:
+		return math.Round(amount)
+	}
+	return math.Round(amount/5) * 5
+}
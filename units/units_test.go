@@ -0,0 +1,101 @@
+package units
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSystem(t *testing.T) {
+	tests := []struct {
+		in   string
+		want System
+		err  error
+	}{
+		{"", ORIGINAL, nil},
+		{"metric", METRIC, nil},
+		{" Imperial ", IMPERIAL, nil},
+		{"cups", ORIGINAL, ErrInvalidSystem},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSystem(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("ParseSystem(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     Quantity
+		factor float64
+		want   Quantity
+	}{
+		{"double", Quantity{2, "cup"}, 2, Quantity{4, "cup"}},
+		{"fractional servings", Quantity{3, "tsp"}, 0.5, Quantity{1.5, "tsp"}},
+		{"zero servings", Quantity{250, "ml"}, 0, Quantity{0, "ml"}},
+		{"unknown unit", Quantity{2, "pinch"}, 1.5, Quantity{3, "pinch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Scale(tt.in, tt.factor); got != tt.want {
+				t.Errorf("Scale(%v, %v) = %v, want %v", tt.in, tt.factor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     Quantity
+		system System
+		want   Quantity
+	}{
+		// volume
+		{"cup to ml", Quantity{1, "cup"}, METRIC, Quantity{235, "ml"}},
+		{"cups to liters", Quantity{5, "cups"}, METRIC, Quantity{1.18, "l"}},
+		{"ml to tsp", Quantity{10, "ml"}, IMPERIAL, Quantity{2, "tsp"}},
+		{"ml to tbsp", Quantity{30, "ml"}, IMPERIAL, Quantity{2, "tbsp"}},
+		{"ml to cup", Quantity{60, "ml"}, IMPERIAL, Quantity{0.25, "cup"}},
+		{"fluid ounces to ml", Quantity{2, "fl  OZ"}, METRIC, Quantity{59, "ml"}},
+
+		// mass
+		{"grams to ounces", Quantity{100, "g"}, IMPERIAL, Quantity{3.5, "oz"}},
+		{"grams to pounds", Quantity{500, "grams"}, IMPERIAL, Quantity{1.1, "lb"}},
+		{"pounds to grams", Quantity{2, "lb"}, METRIC, Quantity{905, "g"}},
+		{"pounds to kilograms", Quantity{3, "lbs"}, METRIC, Quantity{1.36, "kg"}},
+
+		// display unit thresholds
+		{"just under a liter", Quantity{990, "ml"}, METRIC, Quantity{990, "ml"}},
+		{"a liter", Quantity{1000, "ml"}, METRIC, Quantity{1, "l"}},
+		{"just under a kilogram", Quantity{0.99, "kg"}, METRIC, Quantity{990, "g"}},
+		{"a kilogram", Quantity{1000, "g"}, METRIC, Quantity{1, "kg"}},
+		{"a pound", Quantity{453.592, "g"}, IMPERIAL, Quantity{1, "lb"}},
+
+		// rounding
+		{"spoons round to eighths", Quantity{1.3, "tsp"}, ORIGINAL, Quantity{1.25, "tsp"}},
+		{"tiny spoons keep an eighth", Quantity{0.01, "tsp"}, ORIGINAL, Quantity{0.125, "tsp"}},
+		{"zero stays zero", Quantity{0, "tsp"}, ORIGINAL, Quantity{0, "tsp"}},
+		{"below one", Quantity{0.333, "g"}, ORIGINAL, Quantity{0.33, "g"}},
+		{"below ten", Quantity{3.33, "g"}, ORIGINAL, Quantity{3.3, "g"}},
+		{"below a hundred", Quantity{33.3, "g"}, ORIGINAL, Quantity{33, "g"}},
+		{"hundreds to fives", Quantity{333, "g"}, ORIGINAL, Quantity{335, "g"}},
+		{"original normalizes the unit name", Quantity{1, "Tablespoons"}, ORIGINAL, Quantity{1, "tbsp"}},
+
+		// fallbacks
+		{"unknown unit is kept", Quantity{2, "pinch"}, METRIC, Quantity{2, "pinch"}},
+		{"unknown unit is only rounded", Quantity{1.234, "bag"}, IMPERIAL, Quantity{1.2, "bag"}},
+		{"no unit", Quantity{3, ""}, METRIC, Quantity{3, ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Convert(tt.in, tt.system); got != tt.want {
+				t.Errorf("Convert(%v, %q) = %v, want %v", tt.in, tt.system, got, tt.want)
+			}
+		})
+	}
+}